@@ -0,0 +1,485 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/autoupdate"
+	"github.com/aclisp/kubecon/pkg/jobs"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/aclisp/kubecon/pkg/schedule"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// APIPrefix is where the JSON API lives. It returns the same pkg/page types
+// the HTML pages render, so scripts get the same view of the clusters.
+const APIPrefix = "/api/v1"
+
+// isAPI tells if the request is for the JSON API rather than a page.
+func isAPI(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, APIPrefix+"/")
+}
+
+// renderError renders the error page, or the error in JSON for the API.
+func renderError(c *gin.Context, code int, err string) {
+	if isAPI(c) {
+		c.JSON(code, gin.H{"error": err})
+	} else {
+		c.HTML(code, "error", gin.H{"error": err})
+	}
+}
+
+// PodsAction is the body of a pod action posted to the API. It carries the
+// same fields as the form on the pod list page.
+type PodsAction struct {
+	Action string   `json:"action" binding:"required"`
+	Pods   []string `json:"pods" binding:"required"`
+	Images []string `json:"images,omitempty"`
+	Checks []bool   `json:"checks,omitempty"`
+	// Background queues a job instead of waiting for the action.
+	Background bool `json:"background,omitempty"`
+}
+
+// RolloutRequest is the body of a rolling upgrade posted to the API. Timeout
+// is in seconds, and OnFailure is "rollback" or "pause".
+type RolloutRequest struct {
+	Action    string   `json:"action" binding:"required"`
+	Pods      []string `json:"pods" binding:"required"`
+	Images    []string `json:"images" binding:"required"`
+	BatchSize int      `json:"batchSize,omitempty"`
+	Timeout   int      `json:"timeout,omitempty"`
+	OnFailure string   `json:"onFailure,omitempty"`
+}
+
+// ScheduleRequest is the body of a schedule posted to the API. Action is
+// one of scheduleActions, and Cron is a cron expression.
+type ScheduleRequest struct {
+	Selector string `json:"selector"`
+	Action   string `json:"action" binding:"required"`
+	Checks   []bool `json:"checks,omitempty"`
+	Cron     string `json:"cron" binding:"required"`
+}
+
+func apiListClusters(c *gin.Context) {
+	c.JSON(http.StatusOK, genClusters())
+}
+
+func apiSummary(c *gin.Context) {
+	cluster := c.Param("cluster")
+	summary, err := genSummary(cluster)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func apiListNodes(c *gin.Context) {
+	cluster := c.Param("cluster")
+	list, err := kubeclient.Get(cluster).Nodes().List(labels.Everything(), fields.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, genNodes(cluster, list))
+}
+
+func apiDescribeNode(c *gin.Context) {
+	cluster := c.Param("cluster")
+	nodename := c.Param("no")
+	d, err := genNodeDetail(cluster, nodename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+func apiListPods(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	labelSelector := labels.Everything()
+	if s := c.Query("labelSelector"); s != "" {
+		var err error
+		if labelSelector, err = labels.Parse(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	list, err := kubeclient.Get(cluster).Pods(namespace).List(labelSelector, fields.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pods := filterPods(genPods(list), c.Query("image"), c.Query("status"), c.Query("host"), c.Query("sort"))
+	c.JSON(http.StatusOK, pods)
+}
+
+func apiDescribePod(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, genOnePod(pod))
+}
+
+// apiListPodTags returns the tags the pod's images can be upgraded or
+// downgraded to, as chosen by the action query.
+func apiListPodTags(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	action := c.DefaultQuery("action", "upgrade")
+	if action != "upgrade" && action != "downgrade" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown action %q", action)})
+		return
+	}
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var images []string
+	for _, image := range populatePodImages(pod.Spec.Containers) {
+		images = append(images, image.Image)
+	}
+	c.JSON(http.StatusOK, genSimpleImages(action, images))
+}
+
+func apiListReplicationControllers(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	list, err := kubeclient.Get(cluster).ReplicationControllers(namespace).List(labels.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, genReplicationControllers(list))
+}
+
+func apiListServices(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	list, err := kubeclient.Get(cluster).Services(namespace).List(labels.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, genServices(list))
+}
+
+func apiListEndpoints(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	list, err := kubeclient.Get(cluster).Endpoints(namespace).List(labels.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, genEndpoints(list))
+}
+
+func apiListEvents(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	list, err := kubeclient.Get(cluster).Events(namespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, genEvents(list))
+}
+
+// apiPerformPodsAction performs a PodsAction and returns the pods as they
+// are afterwards.
+func apiPerformPodsAction(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	var action PodsAction
+	if err := c.BindJSON(&action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if action.Background {
+		id, err := submitPodsJob(signedInUser(c), cluster, namespace, action.Action, action.Pods, action.Images, action.Checks)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		job, _ := jobs.Get(id)
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	errs := doPodsAction(signedInUser(c), cluster, namespace, action.Action, action.Pods, action.Images, action.Checks)
+	if len(errs) > 0 {
+		var errors []string
+		for _, e := range errs {
+			errors = append(errors, e.Error())
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": errors})
+		return
+	}
+
+	var pods []page.Pod
+	for _, podname := range action.Pods {
+		pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		pods = append(pods, genOnePod(pod))
+	}
+	c.JSON(http.StatusOK, pods)
+}
+
+func apiListRollouts(c *gin.Context) {
+	c.JSON(http.StatusOK, listRolloutViews(c.Param("cluster"), c.Param("ns")))
+}
+
+func apiDescribeRollout(c *gin.Context) {
+	r := findRollout(c)
+	if r == nil {
+		return
+	}
+	c.JSON(http.StatusOK, r.view())
+}
+
+func apiStartRollout(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	var req RolloutRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.BatchSize == 0 {
+		req.BatchSize = 1
+	}
+	if req.Timeout == 0 {
+		req.Timeout = 300
+	}
+
+	r, err := startRollout(signedInUser(c), cluster, namespace, req.Action, req.Pods, req.Images, req.BatchSize, time.Duration(req.Timeout)*time.Second, req.OnFailure)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, r.view())
+}
+
+func apiControlRollout(c *gin.Context) {
+	if !authorize(c, c.Param("ns"), auth.Write) {
+		return
+	}
+	r := findRollout(c)
+	if r == nil {
+		return
+	}
+	if err := controlRolloutBy(signedInUser(c), r, c.Param("control")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, r.view())
+}
+
+func apiListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, visibleJobs(c))
+}
+
+func apiDescribeJob(c *gin.Context) {
+	job, ok := findJob(c, auth.Read)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func apiCancelJob(c *gin.Context) {
+	job, ok := findJob(c, auth.Write)
+	if !ok {
+		return
+	}
+	if err := jobs.Cancel(job.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	job, _ = jobs.Get(job.ID)
+	c.JSON(http.StatusOK, job)
+}
+
+func apiListSuspendedPods(c *gin.Context) {
+	pods, err := genSuspendedPods(signedInUser(c), c.Param("cluster"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pods)
+}
+
+func apiListSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, namespaceSchedules(c.Param("cluster"), c.Param("ns")))
+}
+
+func apiDescribeSchedule(c *gin.Context) {
+	s, ok := findSchedule(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func apiCreateSchedule(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s, err := newSchedule(signedInUser(c), cluster, namespace, req.Selector, req.Action, req.Checks, req.Cron)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, s)
+}
+
+func apiControlSchedule(c *gin.Context) {
+	if !authorize(c, c.Param("ns"), auth.Write) {
+		return
+	}
+	s, ok := findSchedule(c)
+	if !ok {
+		return
+	}
+	if err := controlScheduleBy(signedInUser(c), s, c.Param("control")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Param("control") == "delete" {
+		c.JSON(http.StatusOK, gin.H{})
+		return
+	}
+	s, _ = schedule.Get(s.ID)
+	c.JSON(http.StatusOK, s)
+}
+
+func apiListUpdates(c *gin.Context) {
+	c.JSON(http.StatusOK, namespaceUpdates(c.Param("cluster"), c.Param("ns")))
+}
+
+func apiControlUpdate(c *gin.Context) {
+	if !authorize(c, c.Param("ns"), auth.Write) {
+		return
+	}
+	u, ok := findUpdate(c)
+	if !ok {
+		return
+	}
+	if err := controlUpdateBy(signedInUser(c), u, c.Param("control")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u, _ = autoupdate.Get(u.ID)
+	c.JSON(http.StatusOK, u)
+}
+
+func apiListDrift(c *gin.Context) {
+	drifts, err := genDrifts(c.Param("cluster"), c.Param("ns"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, drifts)
+}
+
+func apiListNamespaceStaleImages(c *gin.Context) {
+	images, err := genNamespaceStaleImages(c.Param("cluster"), c.Param("ns"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+func apiListNodeStaleImages(c *gin.Context) {
+	images, err := genNodeStaleImages(signedInUser(c), c.Param("cluster"), c.Param("no"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+func apiListImages(c *gin.Context) {
+	r, ok := imageRegistry(c)
+	if !ok {
+		return
+	}
+	repos, catalogErr, err := genImageRepositories(signedInUser(c), c.Param("cluster"), r, c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if catalogErr != nil {
+		c.JSON(http.StatusOK, gin.H{"repositories": repos, "catalogError": catalogErr.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"repositories": repos})
+}
+
+// apiDescribeImage returns the tags of a repository, or with `?tag=` the
+// manifest of a tag.
+func apiDescribeImage(c *gin.Context) {
+	cluster := c.Param("cluster")
+	name := strings.Trim(c.Param("name"), "/")
+	r, ok := imageRegistry(c)
+	if !ok {
+		return
+	}
+	if tag := c.Query("tag"); tag != "" {
+		detail, err := genImageDetail(signedInUser(c), cluster, r, name, tag, c.Query("platform"))
+		if err != nil {
+			renderImageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, detail)
+		return
+	}
+	tags, err := genImageTags(signedInUser(c), cluster, r, name)
+	if err != nil {
+		renderImageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aclisp/kubecon/pkg/audit"
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/diff"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// noisyFields are set by the API server on every write, and would bury the
+// interesting changes.
+var noisyFields = []string{"metadata.resourceVersion", "metadata.generation", "status"}
+
+// recordChange audits an action of user on an object of kind, with the
+// changes from before to after, either of which can be nil. A non nil err
+// is recorded as the result.
+func recordChange(user string, action string, cluster string, namespace string, kind string, name string, before interface{}, after interface{}, err error) {
+	e := audit.Entry{
+		User:      user,
+		Action:    action,
+		Cluster:   cluster,
+		Namespace: namespace,
+		Kind:      kind,
+		Name:      name,
+	}
+	if err != nil {
+		e.Result = err.Error()
+	}
+	if before != nil || after != nil {
+		changes, diffErr := diff.Objects(before, after)
+		if diffErr != nil {
+			glog.Errorf("Can not diff %s '%s/%s': %v", kind, namespace, name, diffErr)
+		}
+		if before != nil && after != nil {
+			changes = diff.Without(changes, noisyFields...)
+		}
+		e.Changes = changes
+	}
+	audit.Record(e)
+}
+
+// snapshot keeps the JSON form of an object as it is now, before it is
+// changed in place.
+func snapshot(obj interface{}) interface{} {
+	v, err := diff.Decode(obj)
+	if err != nil {
+		glog.Errorf("Can not decode %T: %v", obj, err)
+	}
+	return v
+}
+
+// redactConfig hides the secrets of a cluster config from the audit log.
+func redactConfig(cfg kubeclient.Config) kubeclient.Config {
+	if cfg.Password != "" {
+		cfg.Password = "******"
+	}
+	if cfg.BearerToken != "" {
+		cfg.BearerToken = "******"
+	}
+	return cfg
+}
+
+// signedInUser returns the user set by the auth middleware.
+func signedInUser(c *gin.Context) string {
+	return c.MustGet(gin.AuthUserKey).(string)
+}
+
+// listAuditEntries shows the latest audit entries of the namespaces the user
+// can read. Cluster scoped entries need the right to read the cluster.
+func listAuditEntries(c *gin.Context) {
+	user := signedInUser(c)
+	filter := audit.Filter{
+		User:      c.Query("user"),
+		Cluster:   c.Query("cluster"),
+		Namespace: c.Query("namespace"),
+		Action:    c.Query("action"),
+		Visible: func(e *audit.Entry) bool {
+			return auth.Allowed(user, e.Cluster, e.Namespace, auth.Read)
+		},
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if err != nil || limit <= 0 {
+		limit = 200
+	}
+	entries, err := audit.Read(filter, limit)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.HTML(http.StatusOK, "auditList", gin.H{
+		"title":   "Sigma Audit",
+		"entries": entries,
+		"queries": map[string]string{
+			"user":      filter.User,
+			"cluster":   filter.Cluster,
+			"namespace": filter.Namespace,
+			"action":    filter.Action,
+			"limit":     strconv.Itoa(limit),
+		},
+	})
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/autoupdate"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/aclisp/kubecon/pkg/registry"
+	"github.com/blang/semver"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// findUpdates looks for newer tags in range for the images of the templates
+// of the replication controllers opting in, in every cluster.
+func findUpdates() (found []autoupdate.Update) {
+	// The tags are listed once per pass.
+	tags := make(map[string][]string)
+	for _, cluster := range kubeclient.Names() {
+		c, ok := kubeclient.Lookup(cluster)
+		if !ok {
+			continue
+		}
+		list, err := c.ReplicationControllers(api.NamespaceAll).List(labels.Everything())
+		if err != nil {
+			glog.Errorf("Can not list replication controllers of %q: %v", cluster, err)
+			continue
+		}
+		for i := range list.Items {
+			rc := &list.Items[i]
+			if rc.Spec.Template == nil {
+				continue
+			}
+			if _, ok := rc.Spec.Template.Annotations[autoupdate.RangeAnnotation]; ok {
+				found = append(found, replicationControllerUpdates(cluster, rc, tags)...)
+			}
+		}
+	}
+	return
+}
+
+// replicationControllerUpdates returns the updates of the containers of the
+// template of rc. Tags caches the tags of the images.
+func replicationControllerUpdates(cluster string, rc *api.ReplicationController, tags map[string][]string) (found []autoupdate.Update) {
+	spec := rc.Spec.Template.Annotations[autoupdate.RangeAnnotation]
+	versions, err := autoupdate.ParseRange(spec)
+	if err != nil {
+		glog.Warningf("Bad %s of '%s/%s/%s': %v", autoupdate.RangeAnnotation, cluster, rc.Namespace, rc.Name, err)
+		return nil
+	}
+	mode := updateMode(rc.Spec.Template.Annotations)
+	for i, container := range rc.Spec.Template.Spec.Containers {
+		if _, _, ok := registry.Find(container.Image); !ok {
+			continue
+		}
+		name, tag := splitImage(container.Image)
+		if _, ok := tags[name]; !ok {
+			tags[name] = getImageTags(registry.Short(name))
+		}
+		if indexOf(tags[name], tag) < 0 {
+			glog.Warningf("Skip auto-updating '%s/%s/%s' container %q: tag %q not found on the registry", cluster, rc.Namespace, rc.Name, container.Name, tag)
+			continue
+		}
+		in := versions
+		if strings.TrimSpace(spec) == "*" {
+			in = nil
+		}
+		newer := newerTag(tags[name], tag, in)
+		if newer == "" {
+			continue
+		}
+		found = append(found, autoupdate.Update{
+			Cluster:               cluster,
+			Namespace:             rc.Namespace,
+			ReplicationController: rc.Name,
+			Container:             container.Name,
+			Index:                 i,
+			From:                  container.Image,
+			To:                    name + ":" + newer,
+			Range:                 spec,
+			Mode:                  mode,
+		})
+	}
+	return
+}
+
+// newerTag returns the newest of the tags, oldest first, after tag and in
+// the range, or "" if there is none or tag is not listed. When tag is a
+// version, only the greater versions with the same prefix are taken. A nil
+// range takes any of them, and when tag is not a version, the tags after it
+// which are not versions either.
+func newerTag(tags []string, tag string, in semver.Range) string {
+	i := indexOf(tags, tag)
+	if i < 0 {
+		return ""
+	}
+	current, currentErr := page.ParseImageTag(tag)
+	for j := len(tags) - 1; j > i; j-- {
+		v, err := page.ParseImageTag(tags[j])
+		switch {
+		case err == nil && currentErr == nil:
+			if v.Prefix == current.Prefix && v.Version.GT(current.Version) && (in == nil || in(v.Version)) {
+				return tags[j]
+			}
+		case err != nil && currentErr != nil && in == nil:
+			// Neither is a version, the version policy tells which is newer.
+			return tags[j]
+		}
+	}
+	return ""
+}
+
+func updateMode(annotations map[string]string) string {
+	if annotations[autoupdate.ModeAnnotation] == autoupdate.ModeAuto {
+		return autoupdate.ModeAuto
+	}
+	return autoupdate.ModeApprove
+}
+
+// applyUpdate sets the new image in the template of the replication
+// controller, and upgrades the pods still running the old one in a job.
+func applyUpdate(u autoupdate.Update, user string) (string, error) {
+	if _, ok := kubeclient.Lookup(u.Cluster); !ok {
+		return "", fmt.Errorf("Cluster %q not found", u.Cluster)
+	}
+	err := modifyReplicationController(user, "auto-update", u.Cluster, u.Namespace, u.ReplicationController, func(rc *api.ReplicationController) error {
+		if rc.Spec.Template == nil || u.Index >= len(rc.Spec.Template.Spec.Containers) {
+			return fmt.Errorf("The template of %q has no container %d", rc.Name, u.Index)
+		}
+		container := &rc.Spec.Template.Spec.Containers[u.Index]
+		if container.Image != u.From {
+			return fmt.Errorf("Container %q of the template runs %s now, not %s", container.Name, container.Image, u.From)
+		}
+		container.Image = u.To
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	list, err := kubeclient.Get(u.Cluster).Pods(u.Namespace).List(labels.SelectorFromSet(labels.Set{"managed-by": u.ReplicationController}), fields.Everything())
+	if err != nil {
+		return "", err
+	}
+	var pods []string
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if u.Index < len(pod.Spec.Containers) && pod.Spec.Containers[u.Index].Image == u.From {
+			pods = append(pods, pod.Name)
+		}
+	}
+	if len(pods) == 0 {
+		return "", nil
+	}
+	images := make([]string, u.Index+1)
+	images[u.Index] = registry.Short(u.To)
+	return submitPodsJob(user, u.Cluster, u.Namespace, "upgrade", pods, images, nil)
+}
+
+// watchedReplicationController is a replication controller opting in to the
+// automatic updates.
+type watchedReplicationController struct {
+	Name  string `json:"name"`
+	Range string `json:"range"`
+	Mode  string `json:"mode"`
+	Error string `json:"error,omitempty"`
+}
+
+// genWatchedReplicationControllers lists the replication controllers of the
+// namespace opting in.
+func genWatchedReplicationControllers(cluster string, namespace string) ([]watchedReplicationController, error) {
+	list, err := kubeclient.Get(cluster).ReplicationControllers(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var watched []watchedReplicationController
+	for i := range list.Items {
+		rc := &list.Items[i]
+		if rc.Spec.Template == nil {
+			continue
+		}
+		spec, ok := rc.Spec.Template.Annotations[autoupdate.RangeAnnotation]
+		if !ok {
+			continue
+		}
+		w := watchedReplicationController{Name: rc.Name, Range: spec, Mode: updateMode(rc.Spec.Template.Annotations)}
+		if _, err := autoupdate.ParseRange(spec); err != nil {
+			w.Error = err.Error()
+		}
+		watched = append(watched, w)
+	}
+	return watched, nil
+}
+
+func namespaceUpdates(cluster string, namespace string) []autoupdate.Update {
+	return autoupdate.List(func(u *autoupdate.Update) bool {
+		return u.Cluster == cluster && u.Namespace == namespace
+	})
+}
+
+// controlUpdateBy approves or rejects an update as user.
+func controlUpdateBy(user string, u autoupdate.Update, control string) error {
+	var err error
+	switch control {
+	case "approve":
+		err = autoupdate.Approve(u.ID, user)
+	case "reject":
+		err = autoupdate.Reject(u.ID, user)
+	default:
+		return fmt.Errorf("Unknown control %q", control)
+	}
+	recordChange(user, control, u.Cluster, u.Namespace, "Update", u.ID, nil, nil, err)
+	return err
+}
+
+// findUpdate returns the update of the request, or renders an error.
+func findUpdate(c *gin.Context) (autoupdate.Update, bool) {
+	u, ok := autoupdate.Get(c.Param("id"))
+	if !ok || u.Cluster != c.Param("cluster") || u.Namespace != c.Param("ns") {
+		renderError(c, http.StatusNotFound, fmt.Sprintf("Update %q not found", c.Param("id")))
+		return u, false
+	}
+	return u, true
+}
+
+func listUpdates(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	watched, err := genWatchedReplicationControllers(cluster, namespace)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.HTML(http.StatusOK, "updateList", gin.H{
+		"cluster":   cluster,
+		"title":     namespace,
+		"namespace": namespace,
+		"watched":   watched,
+		"updates":   namespaceUpdates(cluster, namespace),
+		"interval":  autoupdate.Interval,
+	})
+}
+
+// checkUpdates polls the registries now.
+func checkUpdates(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+	autoupdate.CheckNow()
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/updates", cluster, namespace))
+}
+
+func controlUpdate(c *gin.Context) {
+	if !authorize(c, c.Param("ns"), auth.Write) {
+		return
+	}
+	u, ok := findUpdate(c)
+	if !ok {
+		return
+	}
+	if err := controlUpdateBy(signedInUser(c), u, c.PostForm("control")); err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/updates", u.Cluster, u.Namespace))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aclisp/kubecon/pkg/autoupdate"
+	"github.com/blang/semver"
+)
+
+func TestNewerTag(t *testing.T) {
+	tags := []string{"1.1.0", "v1.2.0", "1.2.0", "1.2.5", "1.3.0", "2.0.0"}
+	dates := []string{"20160101", "20160201", "20160301"}
+	tests := []struct {
+		tags  []string
+		tag   string
+		spec  string
+		newer string
+	}{
+		{tags, "1.2.0", "~1.2", "1.2.5"},
+		{tags, "1.2.0", "^1.2", "1.3.0"},
+		{tags, "1.2.5", "~1.2", ""},
+		{tags, "1.2.0", "*", "2.0.0"},
+		{tags, "2.0.0", "*", ""},
+		// Only the tags with the same prefix.
+		{tags, "v1.2.0", "*", ""},
+		// An unknown tag is never updated, even by "*".
+		{tags, "9.9.9", "*", ""},
+		{tags, "1.2.1", "~1.2", ""},
+		{dates, "20160101", "*", "20160301"},
+		{dates, "20160101", "~1.2", ""},
+		{append([]string{"1.0.0"}, dates...), "1.0.0", "*", ""},
+	}
+	for _, test := range tests {
+		var in semver.Range
+		if test.spec != "*" {
+			versions, err := autoupdate.ParseRange(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in = versions
+		}
+		if got := newerTag(test.tags, test.tag, in); got != test.newer {
+			t.Errorf("newerTag(%v, %q, %q) = %q, want %q", test.tags, test.tag, test.spec, got, test.newer)
+		}
+	}
+}
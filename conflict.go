@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/aclisp/kubecon/pkg/diff"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// conflictRetries is how many more times an update is tried after losing
+// to another update of the same object.
+const conflictRetries = 5
+
+// modifyPod gets the pod, changes it with mutate and updates it, starting
+// over if the pod was updated in between. The update is audited as action
+// of user.
+func modifyPod(user string, action string, cluster string, namespace string, podname string, mutate func(pod *api.Pod) error) error {
+	for attempt := 0; ; attempt++ {
+		pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
+		if err != nil {
+			return err
+		}
+		before := snapshot(pod)
+		if err := mutate(pod); err != nil {
+			return err
+		}
+		_, err = kubeclient.Get(cluster).Pods(namespace).Update(pod)
+		if errors.IsConflict(err) && attempt < conflictRetries {
+			glog.V(2).Infof("Retry updating pod '%s/%s': %v", namespace, podname, err)
+			continue
+		}
+		recordChange(user, action, cluster, namespace, "Pod", podname, before, pod, err)
+		return err
+	}
+}
+
+// modifyReplicationController is modifyPod for a replication controller.
+func modifyReplicationController(user string, action string, cluster string, namespace string, rcname string, mutate func(rc *api.ReplicationController) error) error {
+	for attempt := 0; ; attempt++ {
+		rc, err := kubeclient.Get(cluster).ReplicationControllers(namespace).Get(rcname)
+		if err != nil {
+			return err
+		}
+		before := snapshot(rc)
+		if err := mutate(rc); err != nil {
+			return err
+		}
+		_, err = kubeclient.Get(cluster).ReplicationControllers(namespace).Update(rc)
+		if errors.IsConflict(err) && attempt < conflictRetries {
+			glog.V(2).Infof("Retry updating replication controller '%s/%s': %v", namespace, rcname, err)
+			continue
+		}
+		recordChange(user, action, cluster, namespace, "ReplicationController", rcname, before, rc, err)
+		return err
+	}
+}
+
+// editTarget is an object edited in a JSON editor.
+type editTarget struct {
+	get    func() (runtime.Object, error)
+	update func(obj runtime.Object) error
+	// blank returns an empty object of the same type.
+	blank func() runtime.Object
+}
+
+// editConflict is an edit which changed the same fields as someone else.
+type editConflict struct {
+	Conflicts []diff.Conflict
+	Mine      runtime.Object
+	Latest    runtime.Object
+}
+
+// updateEdited updates the object posted from an editor, which was loaded
+// with original. If the object was updated in between, the changes from
+// original to mine are merged onto the latest object, unless both changed
+// the same fields differently. It returns the object before the update.
+func updateEdited(t editTarget, original string, mine runtime.Object) (before runtime.Object, conflict *editConflict, err error) {
+	before, err = t.get()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = t.update(mine)
+	for attempt := 0; errors.IsConflict(err) && original != "" && attempt < conflictRetries; attempt++ {
+		var latest runtime.Object
+		var conflicts []diff.Conflict
+		var data []byte
+		base := t.blank()
+		if err = json.Unmarshal([]byte(original), base); err != nil {
+			return before, nil, err
+		}
+		if latest, err = t.get(); err != nil {
+			return before, nil, err
+		}
+		if conflicts, err = rebaseEdit(base, mine, latest); err != nil {
+			return before, nil, err
+		}
+		if len(conflicts) > 0 {
+			return latest, &editConflict{Conflicts: conflicts, Mine: mine, Latest: latest}, nil
+		}
+		if data, err = json.Marshal(latest); err != nil {
+			return before, nil, err
+		}
+		before, original = latest, string(data)
+		err = t.update(mine)
+	}
+	return before, nil, err
+}
+
+// rebaseEdit merges the changes from base to mine onto latest, and puts the
+// result into mine.
+func rebaseEdit(base runtime.Object, mine runtime.Object, latest runtime.Object) ([]diff.Conflict, error) {
+	var values [3]interface{}
+	for i, obj := range []runtime.Object{base, mine, latest} {
+		v, err := diff.Decode(obj)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	merged, conflicts := diff.Merge(values[0], values[1], values[2])
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	// Clear mine first, the fields missing from merged are gone.
+	v := reflect.ValueOf(mine).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return nil, json.Unmarshal(data, mine)
+}
+
+// renderConflict shows the three-way diff of a conflicting edit, with a
+// form to post mine again over the latest object.
+func renderConflict(c *gin.Context, name string, editURL string, conflict *editConflict) {
+	latest, err := json.Marshal(conflict.Latest)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	// Overwriting keeps all of mine, based on the latest version.
+	mineMeta, err := api.ObjectMetaFor(conflict.Mine)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	latestMeta, err := api.ObjectMetaFor(conflict.Latest)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	mineMeta.ResourceVersion = latestMeta.ResourceVersion
+	mine, err := json.MarshalIndent(conflict.Mine, "", "  ")
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.HTML(http.StatusConflict, "editConflict", gin.H{
+		"cluster":   c.Param("cluster"),
+		"title":     name,
+		"name":      name,
+		"conflicts": conflict.Conflicts,
+		"editURL":   editURL,
+		"updateURL": c.Request.URL.Path,
+		"mine":      string(mine),
+		"latest":    string(latest),
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/diff"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/aclisp/kubecon/pkg/suspend"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// The states of a drift.
+const (
+	DriftInSync  = "InSync"
+	DriftDrifted = "Drifted"
+	// DriftOrphan is a pod whose replication controller is gone.
+	DriftOrphan = "Orphan"
+)
+
+// genDrifts compares the pods with a `managed-by` label in the namespace
+// with the templates of their replication controllers, the way syncPod
+// and exportPod copy them.
+func genDrifts(cluster string, namespace string) ([]page.Drift, error) {
+	podList, err := kubeclient.Get(cluster).Pods(namespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	rcList, err := kubeclient.Get(cluster).ReplicationControllers(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	rcs := make(map[string]*api.ReplicationController)
+	for i := range rcList.Items {
+		rcs[rcList.Items[i].Name] = &rcList.Items[i]
+	}
+
+	var drifts []page.Drift
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		rcname, ok := pod.Labels["managed-by"]
+		if !ok {
+			continue
+		}
+		drift := page.Drift{Pod: pod.Name, ReplicationController: rcname}
+		rc, ok := rcs[rcname]
+		if !ok || rc.Spec.Template == nil {
+			drift.State = DriftOrphan
+			drift.Error = fmt.Sprintf("Replication controller %q not found", rcname)
+			drifts = append(drifts, drift)
+			continue
+		}
+		drift.Changes, drift.Suspended, err = podDrift(pod, rc.Spec.Template)
+		switch {
+		case err != nil:
+			drift.State = DriftDrifted
+			drift.Error = err.Error()
+		case len(drift.Changes) > 0:
+			drift.State = DriftDrifted
+		default:
+			drift.State = DriftInSync
+		}
+		drifts = append(drifts, drift)
+	}
+	sort.Sort(byDriftState(drifts))
+	return drifts, nil
+}
+
+// byDriftState puts the drifted pods first.
+type byDriftState []page.Drift
+
+func (s byDriftState) Len() int      { return len(s) }
+func (s byDriftState) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDriftState) Less(i, j int) bool {
+	if (s[i].State == DriftInSync) != (s[j].State == DriftInSync) {
+		return s[j].State == DriftInSync
+	}
+	return s[i].Pod < s[j].Pod
+}
+
+// runningSpec returns the spec of the pod with the suspended containers on
+// the images recorded for them, and tells if there are such containers.
+func runningSpec(pod *api.Pod) (spec api.PodSpec, suspended bool, err error) {
+	spec = pod.Spec
+	spec.Containers = append([]api.Container(nil), pod.Spec.Containers...)
+	containers, err := suspend.Get(pod)
+	if err != nil {
+		return spec, false, err
+	}
+	for _, c := range containers {
+		if c.Index < len(spec.Containers) && spec.Containers[c.Index].Image == PauseImage && c.Image != "" {
+			spec.Containers[c.Index].Image = c.Image
+			suspended = true
+		}
+	}
+	return spec, suspended, nil
+}
+
+// podDrift returns the changes from the template to the spec, except the
+// NodeName, and the config/ annotations of the pod. The containers of a
+// suspended pod are compared with the images recorded for them.
+func podDrift(pod *api.Pod, template *api.PodTemplateSpec) (changes []diff.Change, suspended bool, err error) {
+	var spec api.PodSpec
+	if spec, suspended, err = runningSpec(pod); err != nil {
+		return nil, false, err
+	}
+	spec.NodeName = ""
+	templateSpec := template.Spec
+	templateSpec.NodeName = ""
+
+	changes, err = diff.Objects(
+		map[string]interface{}{"spec": templateSpec, "annotations": configAnnotations(template.Annotations)},
+		map[string]interface{}{"spec": spec, "annotations": configAnnotations(pod.Annotations)})
+	return changes, suspended, err
+}
+
+// copyConfigAnnotations makes the config/ annotations of dst those of src,
+// removing the ones src does not have.
+func copyConfigAnnotations(dst map[string]string, src map[string]string) {
+	for k := range configAnnotations(dst) {
+		if _, ok := src[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range configAnnotations(src) {
+		dst[k] = v
+	}
+}
+
+func configAnnotations(annotations map[string]string) map[string]string {
+	config := make(map[string]string)
+	for k, v := range annotations {
+		if strings.HasPrefix(k, "config/") {
+			config[k] = v
+		}
+	}
+	return config
+}
+
+func listDrift(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	drifts, err := genDrifts(cluster, namespace)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	drifted := 0
+	for _, d := range drifts {
+		if d.State != DriftInSync {
+			drifted++
+		}
+	}
+
+	c.HTML(http.StatusOK, "driftList", gin.H{
+		"cluster":   cluster,
+		"title":     namespace,
+		"namespace": namespace,
+		"drifts":    drifts,
+		"drifted":   drifted,
+	})
+}
+
+// resolveDrift syncs a pod from its replication controller, or exports it
+// to the replication controller.
+func resolveDrift(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.PostForm("pod")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	var err error
+	switch c.PostForm("action") {
+	case "sync":
+		err = syncPod(signedInUser(c), cluster, namespace, podname)
+	case "export":
+		var pod *api.Pod
+		if pod, err = kubeclient.Get(cluster).Pods(namespace).Get(podname); err == nil {
+			err = exportPod(signedInUser(c), cluster, namespace, pod)
+		}
+	default:
+		err = fmt.Errorf("Unknown action %q", c.PostForm("action"))
+	}
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/drift", cluster, namespace))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// driftObjects are testObjects with config/ annotations on the pod and the
+// template of its replication controller, each with one the other lacks.
+func driftObjects() []runtime.Object {
+	objects := testObjects()
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *api.Pod:
+			o.Annotations = map[string]string{"config/shared": "1", "config/pod-only": "x", "other": "kept"}
+		case *api.ReplicationController:
+			o.Spec.Template.Annotations = map[string]string{"config/shared": "1", "config/template-only": "y"}
+		}
+	}
+	return objects
+}
+
+func TestResolveDriftRemovesOneSidedAnnotations(t *testing.T) {
+	for _, action := range []string{"sync", "export"} {
+		r, fake := setUp(t, driftObjects()...)
+		drifts, err := genDrifts(testCluster, "rds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(drifts) != 1 || drifts[0].State != DriftDrifted {
+			t.Fatalf("%s: got drifts %+v, want web-1 drifted", action, drifts)
+		}
+
+		w := request(r, "operator", "POST", "/clusters/test/namespaces/rds/drift", url.Values{"pod": {"web-1"}, "action": {action}})
+		if w.Code != http.StatusMovedPermanently {
+			t.Fatalf("%s: got %d: %s", action, w.Code, w.Body)
+		}
+		drifts, err = genDrifts(testCluster, "rds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(drifts) != 1 || drifts[0].State != DriftInSync {
+			t.Errorf("%s: got drifts %+v, want web-1 in sync", action, drifts)
+		}
+
+		pod, err := fake.Pods("rds").Get("web-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := fake.ReplicationControllers("rds").Get("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Annotations["other"] != "kept" {
+			t.Errorf("%s: lost the annotations which are not config/: %v", action, pod.Annotations)
+		}
+		want := map[string]string{"config/shared": "1", "config/template-only": "y"}
+		if action == "export" {
+			want = map[string]string{"config/shared": "1", "config/pod-only": "x"}
+		}
+		for _, annotations := range []map[string]string{pod.Annotations, rc.Spec.Template.Annotations} {
+			if got := configAnnotations(annotations); len(got) != len(want) || got["config/shared"] != "1" {
+				t.Errorf("%s: got %v, want %v", action, got, want)
+			}
+			for k := range want {
+				if _, ok := annotations[k]; !ok {
+					t.Errorf("%s: missing %s in %v", action, k, annotations)
+				}
+			}
+		}
+	}
+}
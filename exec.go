@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/audit"
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"golang.org/x/net/websocket"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// execIdleTimeout closes a terminal which got no input for that long.
+var execIdleTimeout = 10 * time.Minute
+
+// terminalMessage is what the terminal page sends over the WebSocket: the
+// keys typed. The size of the terminal is only given when it opens.
+type terminalMessage struct {
+	Type string `json:"type"` // "input"
+	Data string `json:"data,omitempty"`
+}
+
+// terminalWriter sends the output of the container as binary messages.
+type terminalWriter struct {
+	sync.Mutex
+	ws *websocket.Conn
+}
+
+func (w *terminalWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if err := websocket.Message.Send(w.ws, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *terminalWriter) notice(message string) {
+	fmt.Fprintf(w, "\r\n[%s]\r\n", message)
+}
+
+func terminalSize(c *gin.Context, key string, defaultValue int) int {
+	v, err := strconv.Atoi(c.Query(key))
+	if err != nil || v < 10 || v > 500 {
+		return defaultValue
+	}
+	return v
+}
+
+func showTerminal(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	container := c.Param("ct")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	var containers []string
+	for i := range pod.Spec.Containers {
+		containers = append(containers, pod.Spec.Containers[i].Name)
+	}
+
+	c.HTML(http.StatusOK, "podTerminal", gin.H{
+		"cluster":    cluster,
+		"title":      podname,
+		"namespace":  namespace,
+		"pod":        podname,
+		"container":  container,
+		"containers": containers,
+		"idle":       execIdleTimeout.String(),
+	})
+}
+
+// sameOrigin rejects WebSockets opened by the pages of other sites, which
+// the browser would otherwise sign in with the user's credentials.
+func sameOrigin(config *websocket.Config, req *http.Request) error {
+	if config.Origin == nil || config.Origin.Host != req.Host {
+		return fmt.Errorf("Cross origin WebSocket from %v", config.Origin)
+	}
+	return nil
+}
+
+// execTerminal runs a shell in the container with a TTY, and bridges it to
+// the WebSocket of the terminal page. The exec protocol of the API server
+// has no resize stream, so the size is set with stty when the shell starts
+// and can not change afterwards.
+func execTerminal(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	container := c.Param("ct")
+	user := signedInUser(c)
+	cols := terminalSize(c, "cols", 80)
+	rows := terminalSize(c, "rows", 24)
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			started := time.Now()
+			record := audit.Entry{
+				User:      user,
+				Action:    "exec",
+				Cluster:   cluster,
+				Namespace: namespace,
+				Kind:      "Pod",
+				Name:      podname,
+			}
+			record.Detail = fmt.Sprintf("open terminal of container %q", container)
+			audit.Record(record)
+
+			stdinReader, stdinWriter := io.Pipe()
+			out := &terminalWriter{ws: ws}
+			opts := &api.PodExecOptions{
+				Container: container,
+				Command: []string{"/bin/sh", "-c", fmt.Sprintf(
+					"stty cols %d rows %d 2>/dev/null; if [ -x /bin/bash ]; then exec /bin/bash; else exec /bin/sh; fi", cols, rows)},
+				Stdin:  true,
+				Stdout: true,
+				TTY:    true,
+			}
+			done := make(chan error, 1)
+			go func() {
+				err := kubeclient.Get(cluster).Exec(namespace, podname, opts, stdinReader, out, out)
+				if err != nil {
+					out.notice(err.Error())
+				}
+				out.notice("会话已结束")
+				// Unblocks the receiving loop below if it is writing to
+				// the shell, then ends it.
+				stdinReader.CloseWithError(fmt.Errorf("Shell exited"))
+				ws.Close()
+				done <- err
+			}()
+
+			idle := time.AfterFunc(execIdleTimeout, func() {
+				out.notice(fmt.Sprintf("%v 没有输入，会话已关闭", execIdleTimeout))
+				ws.Close()
+			})
+			defer idle.Stop()
+		receive:
+			for {
+				var data string
+				if err := websocket.Message.Receive(ws, &data); err != nil {
+					break
+				}
+				var msg terminalMessage
+				if err := json.Unmarshal([]byte(data), &msg); err != nil {
+					glog.Warningf("Bad terminal message from user %q: %v", user, err)
+					continue
+				}
+				switch msg.Type {
+				case "input":
+					idle.Reset(execIdleTimeout)
+					if _, err := io.WriteString(stdinWriter, msg.Data); err != nil {
+						break receive
+					}
+				}
+			}
+			// The shell exits on the end of its input.
+			stdinWriter.Close()
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				err = fmt.Errorf("Shell did not exit")
+			}
+
+			record.Detail = fmt.Sprintf("close terminal of container %q after %v", container, time.Since(started))
+			if err != nil {
+				record.Result = err.Error()
+			}
+			audit.Record(record)
+		},
+	}.ServeHTTP(c.Writer, c.Request)
+}
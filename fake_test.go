@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aclisp/kubecon/pkg/audit"
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/jobs"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/registry"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// testCluster is the name the fake cluster is installed under.
+const testCluster = "test"
+
+// The test users, all with the password "secret". Owner is an admin
+// everywhere, operator can write in the namespace rds only, and other is an
+// admin of the namespace other only.
+var testBindings = []auth.Binding{
+	{User: "owner", Namespace: auth.AllNamespaces, Role: auth.RoleAdmin},
+	{User: "operator", Namespace: "rds", Role: auth.RoleOperator},
+	{User: "other", Namespace: "other", Role: auth.RoleAdmin},
+}
+
+var (
+	testRouter *gin.Engine
+	testOnce   sync.Once
+	// testDir is the temporary directory of the users, the audit log and
+	// the jobs.
+	testDir string
+)
+
+// setUp installs a fake cluster serving objects, and returns the router of
+// kubecon. The users, the audit log and the jobs live in a temporary
+// directory shared by the tests.
+func setUp(t *testing.T, objects ...runtime.Object) (*gin.Engine, *kubeclient.Fake) {
+	testOnce.Do(func() {
+		dir, err := ioutil.TempDir("", "kubecon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testDir = dir
+		var users []auth.User
+		sum := sha1.Sum([]byte("secret"))
+		for _, b := range testBindings {
+			users = append(users, auth.User{Name: b.User, Password: "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])})
+		}
+		auth.UsersFile = filepath.Join(dir, "users.json")
+		auth.PolicyFile = filepath.Join(dir, "policy.json")
+		writeJSON(t, auth.UsersFile, users)
+		writeJSON(t, auth.PolicyFile, auth.Policy{Bindings: testBindings})
+		auth.Init()
+
+		audit.File = filepath.Join(dir, "audit.log")
+		audit.Init()
+		jobs.Dir = filepath.Join(dir, "jobs")
+		jobs.Init(runPodsJob, isConflict)
+		registry.File = filepath.Join(dir, "registries.json")
+		registry.Init(registry.Registry{URL: "http://127.0.0.1:1"})
+
+		gin.SetMode(gin.TestMode)
+		kubeclient.DefaultCluster = testCluster
+		testRouter = newRouter()
+	})
+	fake := kubeclient.NewFake(objects...)
+	kubeclient.Set(testCluster, fake)
+	return testRouter, fake
+}
+
+func writeJSON(t *testing.T, filename string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// request sends a request of user, with form as the posted form if it is
+// not nil.
+func request(r http.Handler, user string, method string, path string, form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.SetBasicAuth(user, "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// writes returns the actions of the fake which change the cluster.
+func writes(fake *kubeclient.Fake) (actions []string) {
+	for _, a := range fake.Actions() {
+		switch a.GetVerb() {
+		case "create", "update", "delete", "patch":
+			actions = append(actions, a.GetVerb()+" "+a.GetResource())
+		}
+	}
+	return
+}
+
+// toJSON marshals an object for the json field of the edit forms.
+func toJSON(t *testing.T, obj interface{}) string {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// testObjects are the objects of the fake cluster: a pod managed by a
+// replication controller scaled to 0, a service with its endpoints, and a
+// node, all in the namespace rds.
+func testObjects() []runtime.Object {
+	return []runtime.Object{
+		&api.Namespace{ObjectMeta: api.ObjectMeta{Name: "rds"}},
+		&api.Pod{
+			ObjectMeta: api.ObjectMeta{Name: "web-1", Namespace: "rds", Labels: map[string]string{"managed-by": "web"}},
+			Spec: api.PodSpec{
+				NodeName:   "node-1",
+				Containers: []api.Container{{Name: "web", Image: "web:1.0.0"}},
+			},
+			Status: api.PodStatus{Phase: api.PodRunning},
+		},
+		&api.ReplicationController{
+			ObjectMeta: api.ObjectMeta{Name: "web", Namespace: "rds"},
+			Spec: api.ReplicationControllerSpec{
+				Selector: map[string]string{"managed-by": "web"},
+				Template: &api.PodTemplateSpec{
+					ObjectMeta: api.ObjectMeta{Labels: map[string]string{"managed-by": "web"}},
+					Spec:       api.PodSpec{Containers: []api.Container{{Name: "web", Image: "web:1.0.0"}}},
+				},
+			},
+		},
+		&api.Service{ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: "rds"}},
+		&api.Endpoints{ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: "rds"}},
+		&api.Node{ObjectMeta: api.ObjectMeta{Name: "node-1"}},
+	}
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testDir != "" {
+		os.RemoveAll(testDir)
+	}
+	os.Exit(code)
+}
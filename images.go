@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/kube"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/aclisp/kubecon/pkg/registry"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// imageTagDetails is how many of the newest tags of a repository are read
+// from the registry, besides the tags in use.
+const imageTagDetails = 50
+
+// splitImage returns the name and the tag of an image, which is "latest"
+// if the image has none.
+func splitImage(image string) (name string, tag string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+// imageUsers are the pods or the replication controllers running an image
+// of the registries, by full name:tag.
+type imageUsers map[string][]page.ImageUser
+
+func (u imageUsers) add(images []page.PodImage, namespace string, name string) {
+	seen := make(map[string]bool)
+	for _, image := range images {
+		if !image.PrivateRepo {
+			continue
+		}
+		repo, tag := splitImage(registry.Full(image.Image))
+		key := repo + ":" + tag
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		u[key] = append(u[key], page.ImageUser{Namespace: namespace, Name: name})
+	}
+}
+
+// repository counts the users of the images of the repository, by its full
+// name.
+func (u imageUsers) repository(name string) (count int) {
+	for key, users := range u {
+		if n, _ := splitImage(key); n == name {
+			count += len(users)
+		}
+	}
+	return
+}
+
+// genImageUsers finds the pods and the replication controller templates in
+// the namespaces of cluster the user can read which run an image of the
+// registries. Suspended pods count for the images they were running.
+func genImageUsers(user string, cluster string) (pods imageUsers, templates imageUsers, err error) {
+	podList, err := kubeclient.Get(cluster).Pods(api.NamespaceAll).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, nil, err
+	}
+	rcList, err := kubeclient.Get(cluster).ReplicationControllers(api.NamespaceAll).List(labels.Everything())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pods, templates = make(imageUsers), make(imageUsers)
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if !auth.Allowed(user, cluster, pod.Namespace, auth.Read) {
+			continue
+		}
+		spec, _, err := runningSpec(pod)
+		if err != nil {
+			spec = pod.Spec
+		}
+		pods.add(populatePodImages(spec.Containers), pod.Namespace, pod.Name)
+	}
+	for i := range rcList.Items {
+		rc := &rcList.Items[i]
+		if rc.Spec.Template == nil || !auth.Allowed(user, cluster, rc.Namespace, auth.Read) {
+			continue
+		}
+		templates.add(populatePodImages(rc.Spec.Template.Spec.Containers), rc.Namespace, rc.Name)
+	}
+	return pods, templates, nil
+}
+
+// genImageRepositories lists the repositories of registry r whose name
+// contains query. If the catalog can not be read, the repositories in use
+// are still listed, with the error of the catalog.
+func genImageRepositories(user string, cluster string, r *registry.Registry, query string) (repos []page.ImageRepository, catalogErr error, err error) {
+	pods, templates, err := genImageUsers(user, cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	catalog, catalogErr := r.Catalog()
+	if catalogErr != nil {
+		glog.Errorf("Can not get the catalog of %s: %v", r.URL, catalogErr)
+	}
+
+	names := make(map[string]bool)
+	for _, name := range catalog {
+		names[name] = true
+	}
+	for _, users := range []imageUsers{pods, templates} {
+		for key := range users {
+			repo, _ := splitImage(key)
+			if found, name, _ := registry.Find(repo); found == r && !names[name] {
+				names[name] = false
+			}
+		}
+	}
+	for name, listed := range names {
+		if !strings.Contains(name, query) {
+			continue
+		}
+		repos = append(repos, page.ImageRepository{
+			Name:      name,
+			Pods:      pods.repository(r.Prefix + name),
+			Templates: templates.repository(r.Prefix + name),
+			Missing:   !listed && catalogErr == nil,
+		})
+	}
+	sort.Sort(byRepositoryName(repos))
+	return repos, catalogErr, nil
+}
+
+type byRepositoryName []page.ImageRepository
+
+func (s byRepositoryName) Len() int           { return len(s) }
+func (s byRepositoryName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byRepositoryName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// genImageTags lists the tags of the repository name of registry r, newest
+// first by its version policy, followed by the tags the policy does not
+// understand. Only the newest tags and the tags in use are read from the
+// registry, with the pods and the replication controllers running them.
+func genImageTags(user string, cluster string, r *registry.Registry, name string) ([]page.ImageTag, error) {
+	versions, others, err := r.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	pods, templates, err := genImageUsers(user, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(others)
+	tags := append(reverse(versions), others...)
+	var read []string
+	for i, tag := range tags {
+		key := r.Prefix + name + ":" + tag
+		if i < imageTagDetails || len(pods[key]) > 0 || len(templates[key]) > 0 {
+			read = append(read, tag)
+		}
+	}
+	details := getTagDetails(registry.Short(r.Prefix+name), read)
+
+	result := make([]page.ImageTag, 0, len(tags))
+	for _, tag := range tags {
+		key := r.Prefix + name + ":" + tag
+		result = append(result, page.ImageTag{
+			Tag:       tag,
+			Detail:    details[tag],
+			Pods:      pods[key],
+			Templates: templates[key],
+		})
+	}
+	return result, nil
+}
+
+// genImageDetail reads the manifest of name:tag with its layers. For a
+// manifest list it shows the image with the digest platform, or the default
+// one.
+func genImageDetail(user string, cluster string, r *registry.Registry, name string, tag string, platform string) (*page.ImageDetail, error) {
+	m, err := r.Manifest(name, tag)
+	if err != nil {
+		return nil, err
+	}
+	image, err := r.Image(name, tag)
+	if err != nil {
+		return nil, err
+	}
+	detail := &page.ImageDetail{
+		Name:      name,
+		Tag:       tag,
+		Digest:    m.Digest,
+		MediaType: m.MediaType,
+		Created:   image.Created,
+		Age:       kube.TranslateTimestamp(unversioned.NewTime(image.Created)),
+	}
+
+	if m.IsList() {
+		chosen, ok := m.Default()
+		if !ok {
+			return nil, fmt.Errorf("Manifest list %s:%s is empty", name, tag)
+		}
+		for _, d := range m.Manifests {
+			p := page.ImagePlatform{Platform: "unknown", Digest: d.Digest}
+			if d.Platform != nil {
+				p.Platform = d.Platform.OS + "/" + d.Platform.Architecture
+				if d.Platform.Variant != "" {
+					p.Platform += "/" + d.Platform.Variant
+				}
+			}
+			if d.Digest == platform {
+				chosen = d
+			}
+			if d.Digest == chosen.Digest {
+				detail.Platform = p.Platform
+			}
+			detail.Platforms = append(detail.Platforms, p)
+		}
+		if m, err = r.Manifest(name, chosen.Digest); err != nil {
+			return nil, err
+		}
+	}
+
+	detail.Size = m.Size()
+	if m.Config.Digest != "" {
+		config := imageLayer(m.Config)
+		detail.Config = &config
+	}
+	for _, layer := range m.Layers {
+		detail.Layers = append(detail.Layers, imageLayer(layer))
+	}
+
+	pods, templates, err := genImageUsers(user, cluster)
+	if err != nil {
+		return nil, err
+	}
+	detail.Pods = pods[r.Prefix+name+":"+tag]
+	detail.Templates = templates[r.Prefix+name+":"+tag]
+	return detail, nil
+}
+
+func imageLayer(d registry.Descriptor) page.ImageLayer {
+	return page.ImageLayer{
+		Digest:      d.Digest,
+		ShortDigest: shortDigest(d.Digest),
+		MediaType:   d.MediaType,
+		Size:        d.Size,
+	}
+}
+
+// shortDigest returns the first 12 hex digits of a digest, as docker shows
+// the IDs of images.
+func shortDigest(digest string) string {
+	hex := digest[strings.Index(digest, ":")+1:]
+	if len(hex) > 12 {
+		return hex[:12]
+	}
+	return hex
+}
+
+// formatBytes shows a size such as 1.5 MB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// imageRegistry returns the registry of `?registry=`, the default one if it
+// is empty.
+func imageRegistry(c *gin.Context) (*registry.Registry, bool) {
+	r, ok := registry.Get(c.Query("registry"))
+	if !ok {
+		renderError(c, http.StatusNotFound, fmt.Sprintf("Unknown registry %q", c.Query("registry")))
+	}
+	return r, ok
+}
+
+func listImages(c *gin.Context) {
+	cluster := c.Param("cluster")
+	query := c.Query("q")
+
+	r, ok := imageRegistry(c)
+	if !ok {
+		return
+	}
+	repos, catalogErr, err := genImageRepositories(signedInUser(c), cluster, r, query)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	var catalogError string
+	if catalogErr != nil {
+		catalogError = catalogErr.Error()
+	}
+
+	c.HTML(http.StatusOK, "imageList", gin.H{
+		"cluster":      cluster,
+		"title":        "Images",
+		"registries":   registry.All(),
+		"registry":     r,
+		"query":        query,
+		"repositories": repos,
+		"catalogError": catalogError,
+	})
+}
+
+// describeImage shows the tags of a repository, or with `?tag=` the layers
+// of a tag. The names of repositories have slashes, so they are the rest of
+// the path.
+func describeImage(c *gin.Context) {
+	cluster := c.Param("cluster")
+	name := strings.Trim(c.Param("name"), "/")
+	tag := c.Query("tag")
+
+	r, ok := imageRegistry(c)
+	if !ok {
+		return
+	}
+	if name == "" {
+		c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/images?registry=%s", cluster, r.Name))
+		return
+	}
+
+	if tag != "" {
+		detail, err := genImageDetail(signedInUser(c), cluster, r, name, tag, c.Query("platform"))
+		if err != nil {
+			renderImageError(c, err)
+			return
+		}
+		c.HTML(http.StatusOK, "imageTag", gin.H{
+			"cluster":  cluster,
+			"title":    name + ":" + tag,
+			"registry": r,
+			"image":    detail,
+		})
+		return
+	}
+
+	tags, err := genImageTags(signedInUser(c), cluster, r, name)
+	if err != nil {
+		renderImageError(c, err)
+		return
+	}
+	c.HTML(http.StatusOK, "imageDetail", gin.H{
+		"cluster":  cluster,
+		"title":    name,
+		"registry": r,
+		"policy":   r.Policy(name).String(),
+		"name":     name,
+		"tags":     tags,
+	})
+}
+
+// renderImageError shows a repository or a tag missing from the registry as
+// not found.
+func renderImageError(c *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	if registry.IsNotFound(err) {
+		code = http.StatusNotFound
+	}
+	renderError(c, code, err.Error())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/jobs"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/api/errors"
+)
+
+// submitPodsJob queues a pods action of user to run in the background, and
+// returns the ID of the job.
+func submitPodsJob(user string, cluster string, namespace string, action string, pods []string, images []string, checks []bool) (string, error) {
+	if !podsActions[action] {
+		return "", fmt.Errorf("Unknown action %q", action)
+	}
+	return jobs.Submit(jobs.Job{
+		User:      user,
+		Cluster:   cluster,
+		Namespace: namespace,
+		Action:    action,
+		Images:    images,
+		Checks:    checks,
+	}, pods)
+}
+
+// runPodsJob performs the action of a job on one pod.
+func runPodsJob(job jobs.Job, podname string) error {
+	return doPodAction(job.User, job.Cluster, job.Namespace, job.Action, podname, fullImageNames(job.Images), job.Checks)
+}
+
+// isConflict tells if an update lost to another one, and is worth another
+// try with the latest resourceVersion.
+func isConflict(err error) bool {
+	return errors.IsConflict(err)
+}
+
+// findJob returns the job of the request if the user can see it, or renders
+// an error.
+func findJob(c *gin.Context, verb auth.Verb) (jobs.Job, bool) {
+	job, ok := jobs.Get(c.Param("id"))
+	if !ok {
+		renderError(c, http.StatusNotFound, fmt.Sprintf("Job %q not found", c.Param("id")))
+		return job, false
+	}
+	if !auth.Allowed(signedInUser(c), job.Cluster, job.Namespace, verb) {
+		renderError(c, http.StatusForbidden, fmt.Sprintf("User %q has no %s permission on %q", signedInUser(c), verb, job.Cluster+"/"+job.Namespace))
+		return job, false
+	}
+	return job, true
+}
+
+// visibleJobs returns the jobs in the namespaces the user can read.
+func visibleJobs(c *gin.Context) []jobs.Job {
+	user := signedInUser(c)
+	return jobs.List(func(j *jobs.Job) bool {
+		return auth.Allowed(user, j.Cluster, j.Namespace, auth.Read)
+	})
+}
+
+func listJobs(c *gin.Context) {
+	c.HTML(http.StatusOK, "jobList", gin.H{
+		"title": "Sigma Jobs",
+		"jobs":  visibleJobs(c),
+	})
+}
+
+func showJob(c *gin.Context) {
+	job, ok := findJob(c, auth.Read)
+	if !ok {
+		return
+	}
+	refresh := ""
+	if !job.Done() {
+		refresh = "2"
+	}
+	back := c.Query("back")
+	if !isLocalPath(back) {
+		back = ""
+	}
+
+	c.HTML(http.StatusOK, "jobDetail", gin.H{
+		"cluster": job.Cluster,
+		"title":   job.ID,
+		"job":     job,
+		"back":    back,
+		"refresh": refresh,
+	})
+}
+
+// isLocalPath tells if the browser stays on kubecon when it goes to path.
+// Browsers read a backslash as a slash and drop tabs and newlines, so
+// "/\evil.com" and "/\t/evil.com" are other hosts.
+func isLocalPath(path string) bool {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsAny(path, "\\\t\r\n") {
+		return false
+	}
+	u, err := url.Parse(path)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+func cancelJob(c *gin.Context) {
+	job, ok := findJob(c, auth.Write)
+	if !ok {
+		return
+	}
+	if err := jobs.Cancel(job.ID); err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusMovedPermanently, "/jobs/"+job.ID)
+}
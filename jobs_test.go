@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestIsLocalPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/clusters/test/namespaces/rds/pods", true},
+		{"/clusters/test/namespaces/rds/pods?labelSelector=app%3Dweb", true},
+		{"", false},
+		{"clusters/test", false},
+		{"//evil.com", false},
+		{"/\\evil.com", false},
+		{"/\t/evil.com", false},
+		{"http://evil.com/", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, test := range tests {
+		if got := isLocalPath(test.path); got != test.want {
+			t.Errorf("isLocalPath(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Terminal is a minimal dumb terminal bridged to a WebSocket. It shows the
+// output with the ANSI escape sequences removed, and sends every key typed
+// as {"type": "input", "data": ...}. Its size is fixed when it opens, since
+// the exec protocol of the API server can not resize a TTY.
+function Terminal(element, path, onStatus) {
+    var maxLines = 5000;
+    var text = '';
+    var decoder = window.TextDecoder ? new TextDecoder('utf-8') : null;
+    var ansi = /\x1b\[[0-9;?]*[ -\/]*[@-~]|\x1b\][^\x07]*(\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>78]/g;
+
+    function size() {
+        var probe = document.createElement('span');
+        probe.textContent = 'M';
+        element.appendChild(probe);
+        var w = probe.getBoundingClientRect().width || 8;
+        var h = probe.getBoundingClientRect().height || 16;
+        element.removeChild(probe);
+        return {
+            cols: Math.max(10, Math.floor(element.clientWidth / w) - 1),
+            rows: Math.max(10, Math.floor(element.clientHeight / h))
+        };
+    }
+
+    function write(data) {
+        data = data.replace(ansi, '').replace(/\r\n/g, '\n');
+        for (var i = 0; i < data.length; i++) {
+            var ch = data.charAt(i);
+            if (ch === '\b') {
+                text = text.slice(0, -1);
+            } else if (ch === '\r' || ch === '\x07') {
+                // Carriage returns without a newline and bells are dropped.
+            } else {
+                text += ch;
+            }
+        }
+        var lines = text.split('\n');
+        if (lines.length > maxLines) {
+            text = lines.slice(lines.length - maxLines).join('\n');
+        }
+        element.textContent = text;
+        element.scrollTop = element.scrollHeight;
+    }
+
+    var initial = size();
+    var scheme = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
+    var ws = new WebSocket(scheme + window.location.host + path + '?cols=' + initial.cols + '&rows=' + initial.rows);
+    ws.binaryType = 'arraybuffer';
+
+    function send(message) {
+        if (ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify(message));
+        }
+    }
+
+    ws.onopen = function() {
+        onStatus('已连接');
+        element.focus();
+    };
+    ws.onmessage = function(e) {
+        if (typeof e.data === 'string') {
+            write(e.data);
+        } else if (decoder) {
+            write(decoder.decode(new Uint8Array(e.data), {stream: true}));
+        } else {
+            write(String.fromCharCode.apply(null, new Uint8Array(e.data)));
+        }
+    };
+    ws.onclose = function() {
+        onStatus('连接已断开');
+    };
+
+    var keys = {
+        8: '\x7f', 9: '\t', 13: '\r', 27: '\x1b',
+        33: '\x1b[5~', 34: '\x1b[6~', 35: '\x1b[F', 36: '\x1b[H',
+        37: '\x1b[D', 38: '\x1b[A', 39: '\x1b[C', 40: '\x1b[B', 46: '\x1b[3~'
+    };
+    element.addEventListener('keydown', function(e) {
+        var data = null;
+        if (e.ctrlKey && e.keyCode >= 65 && e.keyCode <= 90) {
+            data = String.fromCharCode(e.keyCode - 64);
+        } else if (keys[e.keyCode]) {
+            data = keys[e.keyCode];
+        }
+        if (data !== null) {
+            e.preventDefault();
+            send({type: 'input', data: data});
+        }
+    });
+    element.addEventListener('keypress', function(e) {
+        if (e.ctrlKey || e.altKey || e.metaKey || !e.charCode) {
+            return;
+        }
+        e.preventDefault();
+        send({type: 'input', data: String.fromCharCode(e.charCode)});
+    });
+    element.addEventListener('paste', function(e) {
+        e.preventDefault();
+        send({type: 'input', data: e.clipboardData.getData('text')});
+    });
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+const (
+	defaultTailLines  = 500
+	defaultLimitBytes = 256 * 1024
+
+	// logKeepAlive is how often an idle log stream sends a comment, so that
+	// proxies in between do not close it.
+	logKeepAlive = 15 * time.Second
+)
+
+// parseLogOptions reads the log options from the query: tailLines and
+// limitBytes, where 0 means no limit, sinceSeconds, and the flags
+// timestamps, previous and follow.
+func parseLogOptions(c *gin.Context, container string) (*api.PodLogOptions, error) {
+	opts := &api.PodLogOptions{Container: container}
+	_, opts.Previous = c.GetQuery("previous")
+	_, opts.Timestamps = c.GetQuery("timestamps")
+	_, opts.Follow = c.GetQuery("follow")
+
+	tailLines, err := queryInt64(c, "tailLines", defaultTailLines)
+	if err != nil {
+		return nil, err
+	}
+	if tailLines > 0 {
+		opts.TailLines = &tailLines
+	}
+	limitBytes, err := queryInt64(c, "limitBytes", defaultLimitBytes)
+	if err != nil {
+		return nil, err
+	}
+	if limitBytes > 0 {
+		opts.LimitBytes = &limitBytes
+	}
+	sinceSeconds, err := queryInt64(c, "sinceSeconds", 0)
+	if err != nil {
+		return nil, err
+	}
+	if sinceSeconds > 0 {
+		opts.SinceSeconds = &sinceSeconds
+	}
+	return opts, nil
+}
+
+func queryInt64(c *gin.Context, key string, defaultValue int64) (int64, error) {
+	s := c.Query(key)
+	if s == "" {
+		return defaultValue, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("Invalid %s %q", key, s)
+	}
+	return v, nil
+}
+
+// logQueries keeps the log options of the query for the form on the page.
+func logQueries(opts *api.PodLogOptions) map[string]string {
+	queries := map[string]string{
+		"tailLines":    "0",
+		"limitBytes":   "0",
+		"sinceSeconds": "",
+		"timestamps":   strconv.FormatBool(opts.Timestamps),
+		"follow":       strconv.FormatBool(opts.Follow),
+	}
+	if opts.TailLines != nil {
+		queries["tailLines"] = strconv.FormatInt(*opts.TailLines, 10)
+	}
+	if opts.LimitBytes != nil {
+		queries["limitBytes"] = strconv.FormatInt(*opts.LimitBytes, 10)
+	}
+	if opts.SinceSeconds != nil {
+		queries["sinceSeconds"] = strconv.FormatInt(*opts.SinceSeconds, 10)
+	}
+	return queries
+}
+
+func readLog(c *gin.Context, namespace string, podname string, containername string) {
+	cluster := c.Param("cluster")
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	var containers []string
+	for i := range pod.Spec.Containers {
+		containers = append(containers, pod.Spec.Containers[i].Name)
+	}
+
+	container := pod.Spec.Containers[0].Name
+	if len(containername) > 0 {
+		container = containername
+	}
+	logOptions, err := parseLogOptions(c, container)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	// The default limit is left out of the form, so that it does not stick
+	// when the log is followed next.
+	queries := logQueries(logOptions)
+	queries["limitBytes"] = c.Query("limitBytes")
+
+	// In follow mode the page receives the log from streamContainerLog.
+	var out bytes.Buffer
+	if !logOptions.Follow {
+		readCloser, err := kubeclient.Get(cluster).PodLogs(namespace, podname, logOptions)
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+			return
+		}
+		defer readCloser.Close()
+
+		_, err = io.Copy(&out, readCloser)
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.HTML(http.StatusOK, "podLog", gin.H{
+		"cluster":    cluster,
+		"title":      podname,
+		"namespace":  namespace,
+		"pod":        podname,
+		"container":  container,
+		"containers": containers,
+		"log":        out.String(),
+		"previous":   strconv.FormatBool(logOptions.Previous),
+		"queries":    queries,
+	})
+}
+
+func readContainerLog(c *gin.Context) {
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	containername := c.Param("ct")
+
+	readLog(c, namespace, podname, containername)
+}
+
+func readPodLog(c *gin.Context) {
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+
+	readLog(c, namespace, podname, "")
+}
+
+// streamContainerLog follows the log of a container and sends every line as
+// a server-sent event named "line". It sends "end" when the log ends, and
+// "failure" if it can not be read. The upstream stream is closed as soon as
+// the browser goes away.
+func streamContainerLog(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	container := c.Param("ct")
+
+	logOptions, err := parseLogOptions(c, container)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+	logOptions.Follow = true
+	// A followed log has no limit unless one is given, otherwise it would
+	// end at the default limit.
+	if c.Query("limitBytes") == "" {
+		logOptions.LimitBytes = nil
+	}
+
+	readCloser, err := kubeclient.Get(cluster).PodLogs(namespace, podname, logOptions)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	defer readCloser.Close()
+
+	lines := make(chan string)
+	failure := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(readCloser)
+		for {
+			line, err := reader.ReadString('\n')
+			if len(line) > 0 {
+				lines <- strings.TrimRight(line, "\r\n")
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				failure <- err
+				return
+			}
+		}
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	clientGone := c.Writer.CloseNotify()
+	keepAlive := time.NewTicker(logKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-clientGone:
+			glog.V(2).Infof("Stop following log of '%s/%s/%s'", namespace, podname, container)
+			// Closing the upstream unblocks the reader.
+			readCloser.Close()
+			for range lines {
+			}
+			return
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-failure; err != nil {
+					c.SSEvent("failure", err.Error())
+				} else {
+					c.SSEvent("end", "")
+				}
+				c.Writer.Flush()
+				return
+			}
+			c.SSEvent("line", line)
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			io.WriteString(c.Writer, ":\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+const (
+	// maxLogSources caps the containers an aggregated log reads at once.
+	maxLogSources = 100
+	// logReaders is how many of them are read in parallel.
+	logReaders = 10
+)
+
+// logLine is a line of an aggregated log, from the container named by
+// source as "pod/container".
+type logLine struct {
+	Time   time.Time
+	Source string
+	Text   string
+}
+
+func (l logLine) String(timestamps bool) string {
+	if timestamps && !l.Time.IsZero() {
+		return fmt.Sprintf("%s [%s] %s", l.Time.Format(time.RFC3339Nano), l.Source, l.Text)
+	}
+	return fmt.Sprintf("[%s] %s", l.Source, l.Text)
+}
+
+// readAggregatedLog reads the logs of the containers of every pod matching
+// selector, or only the named container, and merges them by time. Only the
+// lines matching filter are kept if it is not nil.
+func readAggregatedLog(cluster string, namespace string, selector labels.Selector, container string, opts api.PodLogOptions, filter *regexp.Regexp) (lines []logLine, errs []error) {
+	podList, err := kubeclient.Get(cluster).Pods(namespace).List(selector, fields.Everything())
+	if err != nil {
+		return nil, []error{err}
+	}
+	type source struct{ pod, container string }
+	var sources []source
+	for _, pod := range podList.Items {
+		for _, ct := range pod.Spec.Containers {
+			if container == "" || ct.Name == container {
+				sources = append(sources, source{pod.Name, ct.Name})
+			}
+		}
+	}
+	if len(sources) > maxLogSources {
+		errs = append(errs, fmt.Errorf("Only read the first %d of %d containers, narrow the label selector", maxLogSources, len(sources)))
+		sources = sources[:maxLogSources]
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	readers := make(chan struct{}, logReaders)
+	for _, s := range sources {
+		wg.Add(1)
+		go func(s source) {
+			defer wg.Done()
+			readers <- struct{}{}
+			defer func() { <-readers }()
+
+			o := opts
+			o.Container = s.container
+			o.Follow = false
+			o.Timestamps = true
+			result, err := readSourceLog(cluster, namespace, s.pod, &o, filter)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				glog.Errorf("Can not read log of '%s/%s/%s': %v", namespace, s.pod, s.container, err)
+				errs = append(errs, fmt.Errorf("%s/%s: %v", s.pod, s.container, err))
+				return
+			}
+			lines = append(lines, result...)
+		}(s)
+	}
+	wg.Wait()
+
+	// Lines of each container are already in order, a stable sort merges
+	// them without reordering lines of the same time.
+	sort.Stable(byLogTime(lines))
+	return lines, errs
+}
+
+func readSourceLog(cluster string, namespace string, podname string, opts *api.PodLogOptions, filter *regexp.Regexp) ([]logLine, error) {
+	readCloser, err := kubeclient.Get(cluster).PodLogs(namespace, podname, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer readCloser.Close()
+
+	source := podname + "/" + opts.Container
+	var lines []logLine
+	reader := bufio.NewReader(readCloser)
+	for {
+		text, err := reader.ReadString('\n')
+		if len(text) > 0 {
+			line := logLine{Source: source, Text: strings.TrimRight(text, "\r\n")}
+			// With timestamps every line starts with an RFC3339 time.
+			if splits := strings.SplitN(line.Text, " ", 2); len(splits) == 2 {
+				if t, err := time.Parse(time.RFC3339Nano, splits[0]); err == nil {
+					line.Time, line.Text = t, splits[1]
+				}
+			}
+			if filter == nil || filter.MatchString(line.Text) {
+				lines = append(lines, line)
+			}
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+type byLogTime []logLine
+
+func (l byLogTime) Len() int           { return len(l) }
+func (l byLogTime) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byLogTime) Less(i, j int) bool { return l[i].Time.Before(l[j].Time) }
+
+// readNamespaceLog shows the merged log of the pods matching labelSelector,
+// keeping the lines matching the grep regexp. With download=txt or
+// download=gz it returns the log as a file instead.
+func readNamespaceLog(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	labelSelectorString := c.Query("labelSelector")
+	container := c.Query("container")
+	grep := c.Query("grep")
+	download := c.Query("download")
+
+	selector, err := labels.Parse(labelSelectorString)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+	var filter *regexp.Regexp
+	if grep != "" {
+		if filter, err = regexp.Compile(grep); err != nil {
+			c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+			return
+		}
+	}
+	logOptions, err := parseLogOptions(c, container)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	lines, errs := readAggregatedLog(cluster, namespace, selector, container, *logOptions, filter)
+
+	switch download {
+	case "":
+	case "txt", "gz":
+		filename := namespace + "-log.txt"
+		var w io.Writer = c.Writer
+		if download == "gz" {
+			filename += ".gz"
+			c.Header("Content-Type", "application/gzip")
+			gz := gzip.NewWriter(c.Writer)
+			defer gz.Close()
+			w = gz
+		} else {
+			c.Header("Content-Type", "text/plain; charset=utf-8")
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+		for _, e := range errs {
+			fmt.Fprintf(w, "# %v\n", e)
+		}
+		for _, line := range lines {
+			fmt.Fprintln(w, line.String(logOptions.Timestamps))
+		}
+		return
+	default:
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": fmt.Sprintf("Unknown download format %q", download)})
+		return
+	}
+
+	var out bytes.Buffer
+	for _, line := range lines {
+		fmt.Fprintln(&out, line.String(logOptions.Timestamps))
+	}
+	var errors []string
+	for _, e := range errs {
+		errors = append(errors, e.Error())
+	}
+	queries := logQueries(logOptions)
+	queries["labelSelector"] = labelSelectorString
+	queries["container"] = container
+	queries["grep"] = grep
+
+	c.HTML(http.StatusOK, "namespaceLog", gin.H{
+		"cluster":   cluster,
+		"title":     namespace,
+		"namespace": namespace,
+		"queries":   queries,
+		"lineCount": len(lines),
+		"log":       out.String(),
+		"errors":    errors,
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLogOptionsLimitBytes(t *testing.T) {
+	tests := []struct {
+		query string
+		limit int64
+	}{
+		{"", defaultLimitBytes},
+		// Follow does not lift the limit, the namespace log reads with it.
+		{"follow", defaultLimitBytes},
+		{"follow&limitBytes=100", 100},
+		{"limitBytes=0", 0},
+	}
+	for _, test := range tests {
+		c, _, _ := gin.CreateTestContext()
+		c.Request, _ = http.NewRequest("GET", "/?"+test.query, nil)
+		opts, err := parseLogOptions(c, "web")
+		if err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+		limit := int64(0)
+		if opts.LimitBytes != nil {
+			limit = *opts.LimitBytes
+		}
+		if limit != test.limit {
+			t.Errorf("%q: got limitBytes %d, want %d", test.query, limit, test.limit)
+		}
+	}
+}
@@ -5,21 +5,34 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
+	"html/template"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aclisp/kubecon/pkg/audit"
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/autoupdate"
+	"github.com/aclisp/kubecon/pkg/cli"
+	"github.com/aclisp/kubecon/pkg/diff"
+	"github.com/aclisp/kubecon/pkg/jobs"
 	"github.com/aclisp/kubecon/pkg/kube"
 	"github.com/aclisp/kubecon/pkg/kubeclient"
 	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/aclisp/kubecon/pkg/registry"
+	"github.com/aclisp/kubecon/pkg/schedule"
+	"github.com/aclisp/kubecon/pkg/suspend"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
@@ -31,77 +44,60 @@ import (
 )
 
 const (
-	PrivateRepoPrefix = "61.160.36.122:8080/"
-	PauseImage        = "sigmas/pause:0.8.0"
+	PauseImage = suspend.PauseImage
 )
 
 var (
-	portMapping *regexp.Regexp
+	portMapping = regexp.MustCompile(`PortMapping\((.*)\)`)
+	// defaultRegistry is the only registry when there is no registry.File.
+	defaultRegistry registry.Registry
 )
 
 func main() {
 	defer glog.Flush()
 
-	flag.StringVar(&kubeclient.KubeConfigFile, "kubeconfig", "kubeconfig.json", "Specify the target API server")
+	// Subcommands such as `kubecon pods stop` run the client, while flags
+	// alone start the server.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := cli.NewCommand().Execute(); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.StringVar(&kubeclient.KubeConfigFile, "kubeconfig", "kubeconfig.json", "Specify the target API server, in kubecon's JSON or the standard kubeconfig format")
+	flag.StringVar(&kubeclient.KubeContext, "context", "", "Specify the context to use in a standard kubeconfig file")
+	flag.StringVar(&auth.UsersFile, "users", "users.htpasswd", "Specify the users in htpasswd or JSON format")
+	flag.StringVar(&auth.PolicyFile, "policy", "policy.json", "Specify the role bindings of users")
+	flag.BoolVar(&kubeclient.UseCache, "cache", true, "Serve the pages from a cache watching the clusters")
+	flag.DurationVar(&execIdleTimeout, "exec-idle-timeout", 10*time.Minute, "Close the web terminals without input for that long")
+	flag.DurationVar(&kubeclient.CacheResync, "cache-resync", 10*time.Minute, "Specify how often the cache relists everything")
+	flag.StringVar(&audit.File, "audit-log", "audit.log", "Specify the file to append the audit entries to")
+	flag.Int64Var(&audit.MaxSize, "audit-max-size", 100*1024*1024, "Rotate the audit log when it grows over that many bytes")
+	flag.IntVar(&audit.MaxBackups, "audit-max-backups", 5, "Specify how many rotated audit logs to keep")
+	flag.StringVar(&jobs.Dir, "jobs-dir", "jobs", "Specify the directory to keep the background jobs in")
+	flag.IntVar(&jobs.Workers, "job-workers", 2, "Specify how many background jobs run at the same time")
+	flag.IntVar(&jobs.Concurrency, "job-concurrency", 5, "Specify how many pods of a background job are worked on at the same time")
+	flag.StringVar(&schedule.File, "schedules", "schedules.json", "Specify the file to keep the scheduled actions in")
+	flag.StringVar(&autoupdate.File, "autoupdates", "autoupdates.json", "Specify the file to keep the automatic image updates in")
+	flag.DurationVar(&autoupdate.Interval, "autoupdate-interval", 5*time.Minute, "Specify how often the registries are polled for the automatic image updates")
+	flag.StringVar(&registry.File, "registries", "registries.json", "Specify the registries and the version policies of their repositories")
+	flag.StringVar(&defaultRegistry.URL, "registry", "http://61.160.36.122:8080", "Specify the URL of the private registry, if there is no registries file")
+	flag.StringVar(&defaultRegistry.Username, "registry-user", "", "Specify the user to sign in the private registry")
+	flag.StringVar(&defaultRegistry.Password, "registry-password", "", "Specify the password to sign in the private registry")
+	flag.BoolVar(&defaultRegistry.Insecure, "registry-insecure", false, "Skip verifying the certificate of the private registry")
+	flag.DurationVar(&registry.Timeout, "registry-timeout", 10*time.Second, "Specify the timeout of the requests to the registries")
 	flag.Set("logtostderr", "true")
 	flag.Parse()
 
 	kubeclient.Init()
-	portMapping = regexp.MustCompile(`PortMapping\((.*)\)`)
-
-	r := gin.Default()
-	r.Static("/js", "js")
-	r.Static("/css", "css")
-	r.Static("/fonts", "fonts")
-	r.Static("/img", "img")
-	r.LoadHTMLGlob("pages/*.html")
-
-	a := r.Group("/", gin.BasicAuth(gin.Accounts{
-		"admin":    "secretsigma",
-		"bamboo":   "oobmab",
-		"default":  "test123",
-		"rds":      "rrddss",
-		"rds-test": "rrddsstt",
-	}))
-
-	a.GET("/", overview)
-	a.GET("/namespaces/:ns", listOthersInNamespace)
-	a.GET("/namespaces/:ns/pods", listPodsInNamespace)
-	a.GET("/namespaces/:ns/pods/:po", describePod)
-	a.GET("/namespaces/:ns/pods/:po/log", readPodLog)
-	a.GET("/namespaces/:ns/pods/:po/containers/:ct/log", readContainerLog)
-	a.GET("/namespaces/:ns/pods/:po/edit", editPod)
-	a.GET("/namespaces/:ns/replicationcontrollers/:rc/edit", editReplicationController)
-	a.GET("/namespaces/:ns/services/:svc/edit", editService)
-	a.GET("/namespaces/:ns/endpoints/:ep/edit", editEndpoints)
-	a.GET("/nodes/:no/edit", editNode)
-	a.GET("/namespaces/:ns/events", listEventsInNamespace)
-	a.GET("/nodes", listNodes)
-	a.GET("/nodes/:no", describeNode)
-	a.GET("/help", help)
-	a.GET("/config", config)
-
-	a.GET("/namespaces/:ns/replicationcontrollers.form", showReplicationControllerForm)
-	a.POST("/namespaces/:ns/replicationcontrollers", createReplicationController)
-
-	a.GET("/namespaces/:ns/services.form", showServiceForm)
-	a.POST("/namespaces/:ns/services", createService)
-
-	a.POST("/namespaces/:ns/pods.form", showPodsForm)
-	a.POST("/namespaces/:ns/pods", performPodsAction)
-
-	a.POST("/config/update", updateConfig)
-	a.POST("/namespaces/:ns/pods/:po/update", updatePod)
-	a.POST("/namespaces/:ns/pods/:po/export", updateReplicationControllerWithPod)
-	a.POST("/namespaces/:ns/pods/:po/import", updatePodWithReplicationController)
-	a.POST("/namespaces/:ns/services/:svc/update", updateService)
-	a.POST("/namespaces/:ns/services/:svc/delete", deleteService)
-	a.POST("/namespaces/:ns/endpoints/:ep/update", updateEndpoints)
-	a.POST("/namespaces/:ns/endpoints/:ep/delete", deleteEndpoints)
-	a.POST("/namespaces/:ns/replicationcontrollers/:rc/update", updateReplicationController)
-	a.POST("/namespaces/:ns/replicationcontrollers/:rc/delete", deleteReplicationController)
-	a.POST("/nodes/:no/update", updateNode)
-	a.POST("/nodes/:no/delete", deleteNode)
+	registry.Init(defaultRegistry)
+	auth.Init()
+	audit.Init()
+	jobs.Init(runPodsJob, isConflict)
+	schedule.Init(runSchedule)
+	autoupdate.Init(findUpdates, applyUpdate)
+	r := newRouter()
 
 	certFile := "kubecon.crt"
 	keyFile := "kubecon.key"
@@ -115,33 +111,234 @@ func main() {
 	r.RunTLS(":8080", certFile, keyFile)
 }
 
+// newRouter sets up the pages, the API and their routes.
+func newRouter() *gin.Engine {
+	r := gin.Default()
+	r.Static("/js", "js")
+	r.Static("/css", "css")
+	r.Static("/fonts", "fonts")
+	r.Static("/img", "img")
+	r.SetHTMLTemplate(template.Must(template.New("").Funcs(template.FuncMap{
+		"clusters":  kubeclient.Names,
+		"proxyPort": proxyPort,
+		"json":      diff.Format,
+		"bytes":     formatBytes,
+	}).ParseGlob("pages/*.html")))
+	r.NoRoute(redirectToDefaultCluster)
+
+	a := r.Group("/", auth.Middleware(scopeOf))
+	a.GET("/", listClusters)
+	a.GET("/help", help)
+	a.GET("/audit", listAuditEntries)
+	a.GET("/jobs", listJobs)
+	a.GET("/jobs/:id", showJob)
+	a.POST("/jobs/:id/cancel", cancelJob)
+	a.GET("/metrics", gin.WrapH(prometheus.Handler()))
+
+	k := a.Group("/clusters/:cluster", checkCluster)
+	k.GET("", overview)
+	k.GET("/namespaces/:ns", listOthersInNamespace)
+	k.GET("/namespaces/:ns/pods", listPodsInNamespace)
+	k.GET("/namespaces/:ns/pods/:po", describePod)
+	k.GET("/namespaces/:ns/pods/:po/log", readPodLog)
+	k.GET("/namespaces/:ns/pods/:po/containers/:ct/log", readContainerLog)
+	k.GET("/namespaces/:ns/pods/:po/containers/:ct/log/stream", streamContainerLog)
+	k.GET("/namespaces/:ns/pods/:po/containers/:ct/terminal", showTerminal)
+	k.GET("/namespaces/:ns/pods/:po/containers/:ct/terminal/ws", execTerminal)
+	k.Any("/namespaces/:ns/pods/:po/proxy/:port/*path", proxyPod)
+	k.GET("/namespaces/:ns/pods/:po/edit", editPod)
+	k.GET("/namespaces/:ns/replicationcontrollers/:rc/edit", editReplicationController)
+	k.GET("/namespaces/:ns/services/:svc/edit", editService)
+	k.GET("/namespaces/:ns/endpoints/:ep/edit", editEndpoints)
+	k.GET("/nodes/:no/edit", editNode)
+	k.GET("/namespaces/:ns/events", listEventsInNamespace)
+	k.GET("/namespaces/:ns/logs", readNamespaceLog)
+	k.GET("/nodes", listNodes)
+	k.GET("/suspended", listSuspendedPods)
+	k.GET("/images", listImages)
+	k.GET("/images/*name", describeImage)
+	k.GET("/nodes/:no", describeNode)
+	k.GET("/nodes/:no/staleness", listNodeStaleImages)
+	k.GET("/config", config)
+
+	k.GET("/namespaces/:ns/replicationcontrollers.form", showReplicationControllerForm)
+	k.POST("/namespaces/:ns/replicationcontrollers", createReplicationController)
+
+	k.GET("/namespaces/:ns/services.form", showServiceForm)
+	k.POST("/namespaces/:ns/services", createService)
+
+	k.POST("/namespaces/:ns/pods.form", showPodsForm)
+	k.POST("/namespaces/:ns/pods", performPodsAction)
+	k.GET("/namespaces/:ns/rollouts", listRollouts)
+	k.GET("/namespaces/:ns/rollouts/:id", showRollout)
+	k.POST("/namespaces/:ns/rollouts/:id/control", controlRollout)
+	k.GET("/namespaces/:ns/drift", listDrift)
+	k.GET("/namespaces/:ns/staleness", listNamespaceStaleImages)
+	k.POST("/namespaces/:ns/drift", resolveDrift)
+	k.GET("/namespaces/:ns/schedules", listSchedules)
+	k.POST("/namespaces/:ns/schedules", createSchedule)
+	k.GET("/namespaces/:ns/schedules/:id", showSchedule)
+	k.POST("/namespaces/:ns/schedules/:id/control", controlSchedule)
+	k.GET("/namespaces/:ns/updates", listUpdates)
+	k.POST("/namespaces/:ns/updates", checkUpdates)
+	k.POST("/namespaces/:ns/updates/:id/control", controlUpdate)
+
+	k.POST("/config/update", updateConfig)
+	k.POST("/namespaces/:ns/pods/:po/update", updatePod)
+	k.POST("/namespaces/:ns/pods/:po/export", updateReplicationControllerWithPod)
+	k.POST("/namespaces/:ns/pods/:po/import", updatePodWithReplicationController)
+	k.POST("/namespaces/:ns/pods/:po/recover", recoverSuspendedPod)
+	k.POST("/namespaces/:ns/services/:svc/update", updateService)
+	k.POST("/namespaces/:ns/services/:svc/delete", deleteService)
+	k.POST("/namespaces/:ns/endpoints/:ep/update", updateEndpoints)
+	k.POST("/namespaces/:ns/endpoints/:ep/delete", deleteEndpoints)
+	k.POST("/namespaces/:ns/replicationcontrollers/:rc/update", updateReplicationController)
+	k.POST("/namespaces/:ns/replicationcontrollers/:rc/delete", deleteReplicationController)
+	k.POST("/nodes/:no/update", updateNode)
+	k.POST("/nodes/:no/delete", deleteNode)
+
+	v := a.Group(APIPrefix)
+	v.GET("/clusters", apiListClusters)
+	v.GET("/jobs", apiListJobs)
+	v.GET("/jobs/:id", apiDescribeJob)
+	v.POST("/jobs/:id/cancel", apiCancelJob)
+	w := v.Group("/clusters/:cluster", checkCluster)
+	w.GET("", apiSummary)
+	w.GET("/nodes", apiListNodes)
+	w.GET("/nodes/:no", apiDescribeNode)
+	w.GET("/nodes/:no/staleness", apiListNodeStaleImages)
+	w.GET("/suspended", apiListSuspendedPods)
+	w.GET("/images", apiListImages)
+	w.GET("/images/*name", apiDescribeImage)
+	w.GET("/namespaces/:ns/pods", apiListPods)
+	w.GET("/namespaces/:ns/pods/:po", apiDescribePod)
+	w.PUT("/namespaces/:ns/pods/:po", apiUpdateObject("Pod"))
+	w.PUT("/namespaces/:ns/replicationcontrollers/:rc", apiUpdateObject("ReplicationController"))
+	w.PUT("/namespaces/:ns/services/:svc", apiUpdateObject("Service"))
+	w.PUT("/namespaces/:ns/endpoints/:ep", apiUpdateObject("Endpoints"))
+	w.PUT("/nodes/:no", apiUpdateObject("Node"))
+	w.GET("/namespaces/:ns/pods/:po/tags", apiListPodTags)
+	w.GET("/namespaces/:ns/replicationcontrollers", apiListReplicationControllers)
+	w.GET("/namespaces/:ns/services", apiListServices)
+	w.GET("/namespaces/:ns/endpoints", apiListEndpoints)
+	w.GET("/namespaces/:ns/events", apiListEvents)
+	w.POST("/namespaces/:ns/pods", apiPerformPodsAction)
+	w.GET("/namespaces/:ns/rollouts", apiListRollouts)
+	w.POST("/namespaces/:ns/rollouts", apiStartRollout)
+	w.GET("/namespaces/:ns/rollouts/:id", apiDescribeRollout)
+	w.POST("/namespaces/:ns/rollouts/:id/:control", apiControlRollout)
+	w.GET("/namespaces/:ns/drift", apiListDrift)
+	w.GET("/namespaces/:ns/staleness", apiListNamespaceStaleImages)
+	w.GET("/namespaces/:ns/schedules", apiListSchedules)
+	w.POST("/namespaces/:ns/schedules", apiCreateSchedule)
+	w.GET("/namespaces/:ns/schedules/:id", apiDescribeSchedule)
+	w.POST("/namespaces/:ns/schedules/:id/:control", apiControlSchedule)
+	w.GET("/namespaces/:ns/updates", apiListUpdates)
+	w.POST("/namespaces/:ns/updates/:id/:control", apiControlUpdate)
+	return r
+}
+
+// scopeOf tells which cluster and namespace a request works on. Nodes and
+// the config are cluster scoped, while the overview and help pages are
+// open to every signed in user.
+func scopeOf(c *gin.Context) (auth.Scope, bool) {
+	cluster := c.Param("cluster")
+	if cluster == "" {
+		return auth.Scope{}, false
+	}
+	scope := auth.Scope{Cluster: cluster, Namespace: c.Param("ns")}
+	if scope.Namespace != "" {
+		return scope, true
+	}
+	path := strings.TrimPrefix(c.Request.URL.Path, APIPrefix)
+	path = strings.TrimPrefix(path, "/clusters/"+cluster)
+	if strings.HasPrefix(path, "/nodes") || strings.HasPrefix(path, "/config") {
+		return scope, true
+	}
+	return auth.Scope{}, false
+}
+
+// checkCluster rejects the requests to an unknown cluster.
+func checkCluster(c *gin.Context) {
+	cluster := c.Param("cluster")
+	if _, ok := kubeclient.Lookup(cluster); !ok {
+		renderError(c, http.StatusNotFound, fmt.Sprintf("Unknown cluster %q", cluster))
+		c.Abort()
+	}
+}
+
+// redirectToDefaultCluster keeps the links from before the multi-cluster
+// support working, by sending them to the default cluster.
+func redirectToDefaultCluster(c *gin.Context) {
+	path := c.Request.URL.Path
+	if strings.HasPrefix(path, "/namespaces") || strings.HasPrefix(path, "/nodes") || strings.HasPrefix(path, "/config") ||
+		strings.HasPrefix(path, "/images") {
+		url := *c.Request.URL
+		url.Path = "/clusters/" + kubeclient.DefaultCluster + path
+		c.Redirect(http.StatusTemporaryRedirect, url.String())
+		return
+	}
+	renderError(c, http.StatusNotFound, "Page not found")
+}
+
 func config(c *gin.Context) {
+	cluster := c.Param("cluster")
+
 	c.HTML(http.StatusOK, "config", gin.H{
-		"title":  "Sigma Config",
-		"config": kubeclient.KubeConfig,
+		"cluster": cluster,
+		"title":   "Sigma Config",
+		"config":  kubeclient.GetConfig(cluster),
 	})
 }
 
 func updateConfig(c *gin.Context) {
-	if c.MustGet(gin.AuthUserKey).(string) != "admin" {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Unauthorized"})
+	cluster := c.Param("cluster")
+
+	if !authorize(c, "", auth.Manage) {
+		return
+	}
+
+	cfg := kubeclient.GetConfig(cluster)
+	if cfg == nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": fmt.Sprintf("Cluster %q can not be configured", cluster)})
+		return
+	}
+	if cfg.KubeConfig != "" {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": fmt.Sprintf("Edit kubeconfig %q instead", cfg.KubeConfig)})
 		return
 	}
+	before := redactConfig(*cfg)
 
-	kubeclient.KubeConfig.APIServerURL = c.PostForm("inputAPIServerURL")
-	kubeclient.KubeConfig.Username = c.PostForm("inputUsername")
-	kubeclient.KubeConfig.Password = c.PostForm("inputPassword")
+	cfg.InCluster = c.PostForm("inputInCluster") == "on"
+	cfg.APIServerURL = c.PostForm("inputAPIServerURL")
+	cfg.Username = c.PostForm("inputUsername")
+	if password := c.PostForm("inputPassword"); password != "" {
+		cfg.Password = password
+	}
+	if token := c.PostForm("inputBearerToken"); token != "" {
+		cfg.BearerToken = token
+	}
+	cfg.CAFile = c.PostForm("inputCAFile")
+	cfg.CertFile = c.PostForm("inputCertFile")
+	cfg.KeyFile = c.PostForm("inputKeyFile")
+	cfg.Insecure = c.PostForm("inputInsecure") == "on"
+	err := kubeclient.Update(cluster, cfg)
+	recordChange(signedInUser(c), "update", cluster, "", "Cluster", cluster, before, redactConfig(*cfg), err)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
 	kubeclient.SaveKubeConfig()
-	kubeclient.Init()
-	c.Redirect(http.StatusMovedPermanently, "/")
+	c.Redirect(http.StatusMovedPermanently, "/clusters/"+cluster)
 }
 
 func editService(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	svcname := c.Param("svc")
 	_, delete := c.GetQuery("delete")
 
-	svc, err := kubeclient.Get().Services(namespace).Get(svcname)
+	svc, err := kubeclient.Get(cluster).Services(namespace).Get(svcname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -161,6 +358,7 @@ func editService(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "serviceEdit", gin.H{
+		"cluster":   cluster,
 		"title":     svcname,
 		"namespace": namespace,
 		"objname":   svcname,
@@ -170,10 +368,11 @@ func editService(c *gin.Context) {
 }
 
 func editNode(c *gin.Context) {
+	cluster := c.Param("cluster")
 	nodename := c.Param("no")
 	_, delete := c.GetQuery("delete")
 
-	node, err := kubeclient.Get().Nodes().Get(nodename)
+	node, err := kubeclient.Get(cluster).Nodes().Get(nodename)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -193,6 +392,7 @@ func editNode(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "nodeEdit", gin.H{
+		"cluster": cluster,
 		"title":   nodename,
 		"objname": nodename,
 		"json":    out.String(),
@@ -201,11 +401,12 @@ func editNode(c *gin.Context) {
 }
 
 func editEndpoints(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	epname := c.Param("ep")
 	_, delete := c.GetQuery("delete")
 
-	ep, err := kubeclient.Get().Endpoints(namespace).Get(epname)
+	ep, err := kubeclient.Get(cluster).Endpoints(namespace).Get(epname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -225,6 +426,7 @@ func editEndpoints(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "endpointsEdit", gin.H{
+		"cluster":   cluster,
 		"title":     epname,
 		"namespace": namespace,
 		"objname":   epname,
@@ -234,11 +436,12 @@ func editEndpoints(c *gin.Context) {
 }
 
 func editReplicationController(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	rcname := c.Param("rc")
 	_, delete := c.GetQuery("delete")
 
-	rc, err := kubeclient.Get().ReplicationControllers(namespace).Get(rcname)
+	rc, err := kubeclient.Get(cluster).ReplicationControllers(namespace).Get(rcname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -258,6 +461,7 @@ func editReplicationController(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "replicationControllerEdit", gin.H{
+		"cluster":   cluster,
 		"title":     rcname,
 		"namespace": namespace,
 		"objname":   rcname,
@@ -267,10 +471,11 @@ func editReplicationController(c *gin.Context) {
 }
 
 func editPod(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	podname := c.Param("po")
 
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -295,6 +500,7 @@ func editPod(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "podEdit", gin.H{
+		"cluster":    cluster,
 		"title":      podname,
 		"namespace":  namespace,
 		"pod":        podname,
@@ -303,91 +509,12 @@ func editPod(c *gin.Context) {
 	})
 }
 
-func readLog(c *gin.Context, namespace string, podname string, containername string, previous bool) {
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
-		return
-	}
-
-	var containers []string
-	for i := range pod.Spec.Containers {
-		containers = append(containers, pod.Spec.Containers[i].Name)
-	}
-
-	container := pod.Spec.Containers[0].Name
-	if len(containername) > 0 {
-		container = containername
-	}
-	limitBytes := int64(256 * 1024)
-	tailLines := int64(500)
-	logOptions := &api.PodLogOptions{
-		Container:  container,
-		Follow:     false,
-		Previous:   previous,
-		Timestamps: false,
-		TailLines:  &tailLines,
-		LimitBytes: &limitBytes,
-	}
-
-	req := kubeclient.Get().RESTClient.
-		Get().
-		Namespace(namespace).
-		Name(podname).
-		Resource("pods").
-		SubResource("log").
-		Param("container", logOptions.Container).
-		Param("follow", strconv.FormatBool(logOptions.Follow)).
-		Param("previous", strconv.FormatBool(logOptions.Previous)).
-		Param("timestamps", strconv.FormatBool(logOptions.Timestamps)).
-		Param("tailLines", strconv.FormatInt(*logOptions.TailLines, 10)).
-		Param("limitBytes", strconv.FormatInt(*logOptions.LimitBytes, 10))
-	readCloser, err := req.Stream()
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
-		return
-	}
-	defer readCloser.Close()
-
-	var out bytes.Buffer
-	_, err = io.Copy(&out, readCloser)
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
-		return
-	}
-
-	c.HTML(http.StatusOK, "podLog", gin.H{
-		"title":      podname,
-		"namespace":  namespace,
-		"pod":        podname,
-		"containers": containers,
-		"log":        out.String(),
-		"previous":   strconv.FormatBool(logOptions.Previous),
-	})
-}
-
-func readContainerLog(c *gin.Context) {
-	namespace := c.Param("ns")
-	podname := c.Param("po")
-	containername := c.Param("ct")
-	_, previous := c.GetQuery("previous")
-
-	readLog(c, namespace, podname, containername, previous)
-}
-
-func readPodLog(c *gin.Context) {
-	namespace := c.Param("ns")
-	podname := c.Param("po")
-	_, previous := c.GetQuery("previous")
-
-	readLog(c, namespace, podname, "", previous)
-}
-
 func describePod(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	podname := c.Param("po")
 
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -412,6 +539,7 @@ func describePod(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "podDetail", gin.H{
+		"cluster":    cluster,
 		"title":      podname,
 		"namespace":  namespace,
 		"pod":        podname,
@@ -421,14 +549,39 @@ func describePod(c *gin.Context) {
 }
 
 func describeNode(c *gin.Context) {
+	cluster := c.Param("cluster")
 	nodename := c.Param("no")
 
-	node, err := kubeclient.Get().Nodes().Get(nodename)
+	d, err := genNodeDetail(cluster, nodename)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
+	c.HTML(http.StatusOK, "nodeDetail", gin.H{
+		"cluster":    cluster,
+		"title":      nodename,
+		"node":       d.Node,
+		"pods":       d.Pods,
+		"events":     d.Events,
+		"nodeEvents": d.NodeEvents,
+	})
+}
+
+// nodeDetail is what the node detail page shows.
+type nodeDetail struct {
+	Node       page.NodeDetail
+	Pods       []page.Pod
+	Events     []page.Event
+	NodeEvents []page.Event
+}
+
+func genNodeDetail(cluster string, nodename string) (*nodeDetail, error) {
+	node, err := kubeclient.Get(cluster).Nodes().Get(nodename)
+	if err != nil {
+		return nil, err
+	}
+
 	d := page.NodeDetail{
 		Name:              node.Name,
 		Labels:            node.Labels,
@@ -437,10 +590,9 @@ func describeNode(c *gin.Context) {
 		Capacity:          kube.TranslateResourseList(node.Status.Capacity),
 		SystemInfo:        node.Status.NodeInfo,
 	}
-	allPods, err := kubeclient.GetAllPods()
+	allPods, err := kubeclient.GetAllPods(cluster)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 	d.Pods = kube.FilterNodePods(allPods, node)
 	d.TerminatedPods, d.NonTerminatedPods = kube.FilterTerminatedPods(d.Pods)
@@ -448,8 +600,7 @@ func describeNode(c *gin.Context) {
 	d.TerminatedPodsResources = computePodsResources(d.TerminatedPods, node)
 	d.AllocatedResources, err = computeNodeResources(d.NonTerminatedPods, node)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 
 	var pods []page.Pod
@@ -463,7 +614,7 @@ func describeNode(c *gin.Context) {
 		glog.Errorf("Unable to construct reference to '%#v': %v", node, err)
 	} else {
 		ref.UID = types.UID(ref.Name)
-		if nodeEventList, err = kubeclient.Get().Events("").Search(ref); err != nil {
+		if nodeEventList, err = kubeclient.Get(cluster).Events("").Search(ref); err != nil {
 			glog.Errorf("Unable to search events for '%#v': %v", node, err)
 		}
 	}
@@ -473,20 +624,19 @@ func describeNode(c *gin.Context) {
 
 	var events []page.Event
 	var eventList *api.EventList
-	if eventList, err = kubeclient.Get().Events("").List(labels.Everything(), fields.Everything()); err != nil {
+	if eventList, err = kubeclient.Get(cluster).Events("").List(labels.Everything(), fields.Everything()); err != nil {
 		glog.Errorf("Unable to search events for '%#v': %v", node, err)
 	}
 	if eventList != nil {
 		events = genEvents(&api.EventList{Items: kube.FilterEventsFromNode(eventList.Items, node)})
 	}
 
-	c.HTML(http.StatusOK, "nodeDetail", gin.H{
-		"title":      nodename,
-		"node":       d,
-		"pods":       pods,
-		"events":     events,
-		"nodeEvents": nodeEvents,
-	})
+	return &nodeDetail{
+		Node:       d,
+		Pods:       pods,
+		Events:     events,
+		NodeEvents: nodeEvents,
+	}, nil
 }
 
 func computeNodeResources(nonTerminated []*api.Pod, node *api.Node) (page.Resources, error) {
@@ -553,20 +703,33 @@ func help(c *gin.Context) {
 }
 
 func overview(c *gin.Context) {
-	namespaces, err := kubeclient.Get().Namespaces().List(labels.Everything(), fields.Everything())
+	cluster := c.Param("cluster")
+	summary, err := genSummary(cluster)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	summary := page.Summary{}
+
+	c.HTML(http.StatusOK, "overview", gin.H{
+		"cluster": cluster,
+		"title":   "Sigma Overview",
+		"summary": summary,
+	})
+}
+
+func genSummary(cluster string) (summary page.Summary, err error) {
+	namespaces, err := kubeclient.Get(cluster).Namespaces().List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return
+	}
 	for i := range namespaces.Items {
 		namespace := namespaces.Items[i].Name
-		podList, err := kubeclient.Get().Pods(namespace).List(labels.Everything(), fields.Everything())
+		podList, err := kubeclient.Get(cluster).Pods(namespace).List(labels.Everything(), fields.Everything())
 		if err != nil {
 			glog.Errorf("Can not get pods in namespace '%s': %v", namespace, err)
 			continue
 		}
-		eventList, err := kubeclient.Get().Events(namespace).List(labels.Everything(), fields.Everything())
+		eventList, err := kubeclient.Get(cluster).Events(namespace).List(labels.Everything(), fields.Everything())
 		if err != nil {
 			glog.Errorf("Can not get events in namespace '%s': %v", namespace, err)
 			eventList = &api.EventList{}
@@ -577,46 +740,82 @@ func overview(c *gin.Context) {
 			EventCount: len(eventList.Items),
 		})
 	}
-	nodeList, err := kubeclient.Get().Nodes().List(labels.Everything(), fields.Everything())
+	nodeList, err := kubeclient.Get(cluster).Nodes().List(labels.Everything(), fields.Everything())
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 	summary.NodeCount = len(nodeList.Items)
+	return
+}
 
-	c.HTML(http.StatusOK, "overview", gin.H{
-		"title":   "Sigma Overview",
-		"summary": summary,
+func listClusters(c *gin.Context) {
+	c.HTML(http.StatusOK, "clusterList", gin.H{
+		"title":    "Sigma Clusters",
+		"clusters": genClusters(),
+		"default":  kubeclient.DefaultCluster,
 	})
 }
 
-func listNodes(c *gin.Context) {
-	if c.MustGet(gin.AuthUserKey).(string) != "admin" {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Unauthorized"})
-		return
+func genClusters() []page.Cluster {
+	names := kubeclient.Names()
+	clusters := make([]page.Cluster, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clusters[i] = genOneCluster(names[i])
+		}(i)
+	}
+	wg.Wait()
+	return clusters
+}
+
+func genOneCluster(cluster string) page.Cluster {
+	result := page.Cluster{Name: cluster}
+	namespaceList, err := kubeclient.Get(cluster).Namespaces().List(labels.Everything(), fields.Everything())
+	if err != nil {
+		glog.Errorf("Can not get namespaces in cluster '%s': %v", cluster, err)
+		result.Error = err.Error()
+		return result
+	}
+	result.NamespaceCount = len(namespaceList.Items)
+	podList, err := kubeclient.Get(cluster).Pods("").List(labels.Everything(), fields.Everything())
+	if err != nil {
+		glog.Errorf("Can not get pods in cluster '%s': %v", cluster, err)
+		result.Error = err.Error()
+		return result
 	}
+	result.PodCount = len(podList.Items)
+	nodeList, err := kubeclient.Get(cluster).Nodes().List(labels.Everything(), fields.Everything())
+	if err != nil {
+		glog.Errorf("Can not get nodes in cluster '%s': %v", cluster, err)
+		result.Error = err.Error()
+		return result
+	}
+	result.NodeCount = len(nodeList.Items)
+	return result
+}
 
-	list, err := kubeclient.Get().Nodes().List(labels.Everything(), fields.Everything())
+func listNodes(c *gin.Context) {
+	cluster := c.Param("cluster")
+	list, err := kubeclient.Get(cluster).Nodes().List(labels.Everything(), fields.Everything())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
 	c.HTML(http.StatusOK, "nodeList", gin.H{
-		"title": "Sigma Nodes",
-		"nodes": genNodes(list),
+		"cluster": cluster,
+		"title":   "Sigma Nodes",
+		"nodes":   genNodes(cluster, list),
 	})
 }
 
 func listPodsInNamespace(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 
-	user := c.MustGet(gin.AuthUserKey).(string)
-	if user != "admin" && user != namespace {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Unauthorized"})
-		return
-	}
-
 	labelSelectorString, ok := c.GetQuery("labelSelector")
 	var labelSelector labels.Selector
 	if !ok {
@@ -629,7 +828,7 @@ func listPodsInNamespace(c *gin.Context) {
 		}
 	}
 
-	list, err := kubeclient.Get().Pods(namespace).List(labelSelector, fields.Everything())
+	list, err := kubeclient.Get(cluster).Pods(namespace).List(labelSelector, fields.Everything())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -638,37 +837,14 @@ func listPodsInNamespace(c *gin.Context) {
 	pods := genPods(list)
 	images, statuses, hosts := page.GetPodsFilters(pods)
 
-	image, ok := c.GetQuery("image")
-	if ok && len(image) > 0 {
-		theImage := page.PodImage{Image: image, PrivateRepo: true}
-		pods = page.FilterPodsByImage(pods, theImage)
-	}
-
-	status, ok := c.GetQuery("status")
-	if ok && len(status) > 0 {
-		pods = page.FilterPodsByStatus(pods, status)
-	}
-
-	host, ok := c.GetQuery("host")
-	if ok && len(host) > 0 {
-		pods = page.FilterPodsByHost(pods, host)
-	}
-
-	sortAlgo, ok := c.GetQuery("sort")
-	if ok && len(sortAlgo) > 0 {
-		switch sortAlgo {
-		case "ByName":
-			sort.Sort(page.ByName(pods))
-		case "ByBirth":
-			sort.Sort(sort.Reverse(page.ByBirth(pods)))
-		default:
-			sort.Sort(sort.Reverse(page.ByBirth(pods)))
-		}
-	} else {
-		sort.Sort(sort.Reverse(page.ByBirth(pods)))
-	}
+	image := c.Query("image")
+	status := c.Query("status")
+	host := c.Query("host")
+	sortAlgo := c.Query("sort")
+	pods = filterPods(pods, image, status, host, sortAlgo)
 
 	c.HTML(http.StatusOK, "podList", gin.H{
+		"cluster":   cluster,
 		"title":     "Sigma Pods",
 		"refresh":   60,
 		"namespace": namespace,
@@ -686,52 +862,65 @@ func listPodsInNamespace(c *gin.Context) {
 	})
 }
 
+// filterPods keeps the pods of the given image, status and host, each of
+// which can be empty, and sorts them by sortAlgo.
+func filterPods(pods []page.Pod, image string, status string, host string, sortAlgo string) []page.Pod {
+	if len(image) > 0 {
+		theImage := page.PodImage{Image: image, PrivateRepo: true}
+		pods = page.FilterPodsByImage(pods, theImage)
+	}
+	if len(status) > 0 {
+		pods = page.FilterPodsByStatus(pods, status)
+	}
+	if len(host) > 0 {
+		pods = page.FilterPodsByHost(pods, host)
+	}
+	switch sortAlgo {
+	case "ByName":
+		sort.Sort(page.ByName(pods))
+	default:
+		sort.Sort(sort.Reverse(page.ByBirth(pods)))
+	}
+	return pods
+}
+
 func listEventsInNamespace(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 
-	user := c.MustGet(gin.AuthUserKey).(string)
-	if user != "admin" && user != namespace {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	list, err := kubeclient.Get().Events(namespace).List(labels.Everything(), fields.Everything())
+	list, err := kubeclient.Get(cluster).Events(namespace).List(labels.Everything(), fields.Everything())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
 	c.HTML(http.StatusOK, "eventList", gin.H{
-		"title":  "Sigma Events",
-		"events": genEvents(list),
+		"cluster": cluster,
+		"title":   "Sigma Events",
+		"events":  genEvents(list),
 	})
 }
 
 func listOthersInNamespace(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 
-	user := c.MustGet(gin.AuthUserKey).(string)
-	if user != "admin" && user != namespace {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Unauthorized"})
-		return
-	}
-
-	rcList, err := kubeclient.Get().ReplicationControllers(namespace).List(labels.Everything())
+	rcList, err := kubeclient.Get(cluster).ReplicationControllers(namespace).List(labels.Everything())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	svcList, err := kubeclient.Get().Services(namespace).List(labels.Everything())
+	svcList, err := kubeclient.Get(cluster).Services(namespace).List(labels.Everything())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	epList, err := kubeclient.Get().Endpoints(namespace).List(labels.Everything())
+	epList, err := kubeclient.Get(cluster).Endpoints(namespace).List(labels.Everything())
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	nodeList, err := kubeclient.Get().Nodes().List(labels.SelectorFromSet(labels.Set{
+	nodeList, err := kubeclient.Get(cluster).Nodes().List(labels.SelectorFromSet(labels.Set{
 		"project": namespace,
 	}), fields.Everything())
 	if err != nil {
@@ -740,18 +929,19 @@ func listOthersInNamespace(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "nsInfo", gin.H{
+		"cluster": cluster,
 		"refresh": 60,
 		"title":   namespace,
 		"ns":      namespace,
 		"rcs":     genReplicationControllers(rcList),
 		"svcs":    genServices(svcList),
 		"eps":     genEndpoints(epList),
-		"nodes":   genNodes(nodeList),
+		"nodes":   genNodes(cluster, nodeList),
 	})
 }
 
-func genNodes(list *api.NodeList) (nodes []page.Node) {
-	allPods, _ := kubeclient.GetAllPods()
+func genNodes(cluster string, list *api.NodeList) (nodes []page.Node) {
+	allPods, _ := kubeclient.GetAllPods(cluster)
 	for i := range list.Items {
 		nodes = append(nodes, genOneNode(&list.Items[i], allPods))
 	}
@@ -957,17 +1147,15 @@ func genOneReplicationController(rc *api.ReplicationController) page.Replication
 	return result
 }
 
+// populatePodImages names the images of the containers as registry.Short
+// does, and tells which come from a configured registry.
 func populatePodImages(containers []api.Container) (images []page.PodImage) {
 	for _, container := range containers {
-		image := page.PodImage{
-			Image:       container.Image,
-			PrivateRepo: false,
-		}
-		if strings.HasPrefix(image.Image, PrivateRepoPrefix) {
-			image.Image = strings.TrimPrefix(image.Image, PrivateRepoPrefix)
-			image.PrivateRepo = true
-		}
-		images = append(images, image)
+		_, _, private := registry.Find(container.Image)
+		images = append(images, page.PodImage{
+			Image:       registry.Short(container.Image),
+			PrivateRepo: private,
+		})
 	}
 	return
 }
@@ -1014,6 +1202,7 @@ func genOneEvent(ev *api.Event) page.Event {
 }
 
 func showPodsForm(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	action := c.PostForm("action")
 	podsJson := c.PostForm("pods")
@@ -1026,86 +1215,125 @@ func showPodsForm(c *gin.Context) {
 		return
 	}
 
-	var images []page.SimpleImage
-	for i, image := range pods[0].Images {
+	images := genSimpleImages(action, pods[0].Images)
+
+	c.HTML(http.StatusOK, "podForm", gin.H{
+		"cluster":   cluster,
+		"title":     action,
+		"action":    action,
+		"namespace": namespace,
+		"pods":      pods,
+		"location":  location,
+		"images":    images,
+	})
+}
+
+// genSimpleImages lists the tags an action can set for each of the first
+// two images of a pod: newer tags to upgrade and older ones to downgrade,
+// in the order of the version policy of the repository. Only the first 50
+// are listed, but the newest tag to upgrade to is always given.
+func genSimpleImages(action string, podImages []string) (images []page.SimpleImage) {
+	for i, image := range podImages {
 		if i > 1 {
 			break
 		}
-		splits := strings.SplitN(image, ":", 2)
-		name := splits[0]
-		tag := "latest"
-		if len(splits) > 1 {
-			tag = splits[1]
-		}
-		var tagList []page.CombinedVersion
+		name, tag := splitImage(image)
+		var tags []string
+		var newest string
 		switch action {
 		case "upgrade":
-			tagList = getImageTags(name)
-			page.SortCombinedVersions(tagList)
-			index := page.SearchCombinedVersions(tagList, tag)
-			tagList = tagList[index+1:]
+			tags = getImageTags(name)
+			tags = tags[indexOf(tags, tag)+1:]
+			if len(tags) > 0 {
+				newest = tags[len(tags)-1]
+			}
 		case "downgrade":
-			tagList = getImageTags(name)
-			page.SortCombinedVersions(tagList)
-			index := page.SearchCombinedVersions(tagList, tag)
+			tags = getImageTags(name)
+			index := indexOf(tags, tag)
 			if index == -1 {
-				index = len(tagList)
+				index = len(tags)
 			}
-			tagList = tagList[:index]
-			page.ReverseCombinedVersions(tagList)
+			tags = reverse(tags[:index])
 		default:
-			tagList = nil
+			tags = nil
+		}
+		if len(tags) > 50 {
+			tags = tags[:50]
 		}
-		tagList = page.LimitCombinedVersions(tagList, 50)
 		images = append(images, page.SimpleImage{
-			Name: name,
-			Tags: page.CombinedVersionsToStrings(tagList),
+			Name:    name,
+			Tags:    tags,
+			Newest:  newest,
+			Details: getTagDetails(name, tags),
 		})
 	}
+	return
+}
 
-	c.HTML(http.StatusOK, "podForm", gin.H{
-		"title":     action,
-		"action":    action,
-		"namespace": namespace,
-		"pods":      pods,
-		"location":  location,
-		"images":    images,
-	})
+func indexOf(list []string, s string) int {
+	for i := range list {
+		if list[i] == s {
+			return i
+		}
+	}
+	return -1
 }
 
-type TagList struct {
-	Name string   `json:"name,omitempty"`
-	Tags []string `json:"tags,omitempty"`
+func reverse(list []string) []string {
+	result := make([]string, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		result = append(result, list[i])
+	}
+	return result
 }
 
-func getImageTags(name string) (tags []page.CombinedVersion) {
-	url := "http://" + PrivateRepoPrefix + "v2/" + name + "/tags/list"
-	res, err := http.Get(url)
-	if err != nil {
-		glog.Errorf("Can not get image %q tags: %v", name, err)
+// getTagDetails reads the digest, size and created time of the tags of an
+// image, named as registry.Short does, from its registry. The tags it fails
+// to read are left out. The registry is asked again for the digests only
+// after registry.DigestTTL, so the forms render from the cache.
+func getTagDetails(image string, tags []string) map[string]page.TagDetail {
+	r, name, ok := registry.Find(registry.Full(image))
+	if !ok || len(tags) == 0 {
 		return nil
 	}
-	defer res.Body.Close()
+	images, errs := r.Images(name, tags)
+	for tag, err := range errs {
+		glog.Warningf("Can not get image %q tag %q: %v", name, tag, err)
+	}
+	details := make(map[string]page.TagDetail)
+	for tag, i := range images {
+		details[tag] = page.TagDetail{
+			Digest:      i.Digest,
+			ShortDigest: shortDigest(i.Digest),
+			Size:        i.Size,
+			Created:     i.Created,
+			Age:         kube.TranslateTimestamp(unversioned.NewTime(i.Created)),
+		}
+	}
+	return details
+}
 
-	var data TagList
-	decoder := json.NewDecoder(res.Body)
-	err = decoder.Decode(&data)
+// getImageTags lists the tags of an image, named as registry.Short does, in
+// the order of the version policy of its repository, oldest first. The tags
+// the policy does not understand are left out.
+func getImageTags(image string) []string {
+	r, name, ok := registry.Find(registry.Full(image))
+	if !ok {
+		return nil
+	}
+	tags, others, err := r.Versions(name)
 	if err != nil {
 		glog.Errorf("Can not get image %q tags: %v", name, err)
 		return nil
 	}
-	for _, t := range data.Tags {
-		v, err := page.ParseImageTag(t)
-		if err != nil {
-			glog.Warningf("Can not parse image %q tag %q: %v", name, t, err)
-			continue
-		}
-		tags = append(tags, v)
+	if len(others) > 0 {
+		glog.V(2).Infof("Tags of image %q not in the %s policy: %v", name, r.Policy(name), others)
 	}
-	return
+	return tags
 }
 
 func performPodsAction(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	action := c.PostForm("action")
 	podsJson := c.PostForm("pods")
@@ -1113,6 +1341,10 @@ func performPodsAction(c *gin.Context) {
 	checksJson := c.PostForm("checks")
 	location := c.PostForm("location")
 
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
 	var pods []string
 	var images []string
 	if err := json.Unmarshal([]byte(podsJson), &pods); err != nil {
@@ -1123,282 +1355,370 @@ func performPodsAction(c *gin.Context) {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	var fullImages []string
-	for _, image := range images {
-		if image == "" {
-			fullImages = append(fullImages, "")
-		} else {
-			fullImages = append(fullImages, PrivateRepoPrefix+image)
-		}
-	}
 	var checks []bool
 	if err := json.Unmarshal([]byte(checksJson), &checks); err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+
+	if c.PostForm("rolling") == "on" {
+		batchSize, timeout, onFailure, err := rolloutOptions(c)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+			return
+		}
+		r, err := startRollout(signedInUser(c), cluster, namespace, action, pods, images, batchSize, timeout, onFailure)
+		if err != nil {
+			c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/rollouts/%s", cluster, namespace, r.ID))
+		return
+	}
+
+	id, err := submitPodsJob(signedInUser(c), cluster, namespace, action, pods, images, checks)
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+	re := regexp.MustCompile("status=([^&]+)")
+	location = re.ReplaceAllString(location, "status=")
+	re = regexp.MustCompile("image=([^&]+)")
+	location = re.ReplaceAllString(location, "image=")
+	c.Redirect(http.StatusMovedPermanently, "/jobs/"+id+"?back="+url.QueryEscape(location))
+}
+
+// doPodsAction performs action of user on the named pods. Images are the
+// new images of the containers to upgrade or downgrade, relative to the
+// private repo, and checks select the containers to start or stop.
+func doPodsAction(user string, cluster string, namespace string, action string, pods []string, images []string, checks []bool) (errs []error) {
+	if !podsActions[action] {
+		return []error{fmt.Errorf("Unknown action %q", action)}
+	}
+	fullImages := fullImageNames(images)
+	for _, podname := range pods {
+		if err := doPodAction(user, cluster, namespace, action, podname, fullImages, checks); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// podsActions are the actions doPodAction knows.
+var podsActions = map[string]bool{
+	"upgrade":   true,
+	"downgrade": true,
+	"start":     true,
+	"stop":      true,
+	"restart":   true,
+	"sync":      true,
+	"delete":    true,
+	// upgrade-latest upgrades each pod to the newest tags of its images.
+	"upgrade-latest": true,
+}
+
+// doPodAction performs action of user on one pod, with the full images.
+func doPodAction(user string, cluster string, namespace string, action string, podname string, fullImages []string, checks []bool) error {
 	if len(checks) == 0 {
 		checks = []bool{true}
 	}
-
-	var errs []error
 	switch action {
 	case "upgrade", "downgrade":
-		for _, podname := range pods {
-			if err := setPodImage(namespace, podname, fullImages); err != nil {
-				errs = append(errs, err)
-			}
-		}
+		_, err := setPodImage(user, action, cluster, namespace, podname, fullImages)
+		return err
 	case "start":
-		for _, podname := range pods {
-			if err := startPod(namespace, podname, checks); err != nil {
-				errs = append(errs, err)
-			}
-		}
+		return startPod(user, cluster, namespace, podname, checks)
 	case "stop":
-		for _, podname := range pods {
-			if err := stopPod(namespace, podname, checks); err != nil {
-				errs = append(errs, err)
-			}
-		}
+		return stopPod(user, cluster, namespace, podname, checks)
 	case "restart":
-		for _, podname := range pods {
-			if err := stopPod(namespace, podname, checks); err != nil {
-				errs = append(errs, err)
-			}
-			if err := startPod(namespace, podname, checks); err != nil {
-				errs = append(errs, err)
-			}
+		if err := stopPod(user, cluster, namespace, podname, checks); err != nil {
+			return err
 		}
+		return startPod(user, cluster, namespace, podname, checks)
 	case "sync":
-		for _, podname := range pods {
-			if err := syncPod(namespace, podname); err != nil {
-				errs = append(errs, err)
-			}
-		}
+		return syncPod(user, cluster, namespace, podname)
+	case "upgrade-latest":
+		return upgradePodToLatest(user, cluster, namespace, podname)
 	case "delete":
+		return nil
 	}
-
-	if len(errs) > 0 {
-		var errors []string
-		for _, e := range errs {
-			errors = append(errors, e.Error())
-		}
-		c.HTML(http.StatusInternalServerError, "errors", gin.H{"errors": errors})
-	} else {
-		re := regexp.MustCompile("status=([^&]+)")
-		location = re.ReplaceAllString(location, "status=")
-		re = regexp.MustCompile("image=([^&]+)")
-		location = re.ReplaceAllString(location, "image=")
-		c.Redirect(http.StatusMovedPermanently, location)
-	}
+	return fmt.Errorf("Unknown action %q", action)
 }
 
-func setPodImage(namespace string, podname string, fullImages []string) error {
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
-	if err != nil {
-		return err
-	}
-
-	for i, image := range fullImages {
+// fullImageNames undoes registry.Short on the images, keeping the empty ones
+// which leave their containers alone.
+func fullImageNames(images []string) (fullImages []string) {
+	for _, image := range images {
 		if image == "" {
-			continue
+			fullImages = append(fullImages, "")
+		} else {
+			fullImages = append(fullImages, registry.Full(image))
 		}
-		glog.Infof("Set image of '%s/%s/%d': %s -> %s", namespace, podname, i, pod.Spec.Containers[i].Image, image)
-		pod.Spec.Containers[i].Image = image
-	}
-	_, err = kubeclient.Get().Pods(namespace).Update(pod)
-	if err != nil {
-		return err
 	}
-	return nil
+	return
 }
 
-func stopPod(namespace string, podname string, checks []bool) error {
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
-	if err != nil {
-		return err
-	}
-
-	for i, check := range checks {
-		if pod.Spec.Containers[i].Image == PauseImage {
-			// Already stopped.
-			continue
+// setPodImage sets the images of the containers of a pod, and returns the
+// images they had before.
+func setPodImage(user string, action string, cluster string, namespace string, podname string, fullImages []string) (previous []string, err error) {
+	err = modifyPod(user, action, cluster, namespace, podname, func(pod *api.Pod) error {
+		previous = nil
+		for i := range pod.Spec.Containers {
+			previous = append(previous, pod.Spec.Containers[i].Image)
 		}
-		if check {
-			paused := fmt.Sprintf("paused%d", i)
-			pod.Annotations[paused] = pod.Spec.Containers[i].Image
-			pod.Spec.Containers[i].Image = PauseImage
+		for i, image := range fullImages {
+			if image == "" || i >= len(pod.Spec.Containers) {
+				continue
+			}
+			glog.Infof("Set image of '%s/%s/%d': %s -> %s", namespace, podname, i, pod.Spec.Containers[i].Image, image)
+			pod.Spec.Containers[i].Image = image
 		}
-	}
-
-	_, err = kubeclient.Get().Pods(namespace).Update(pod)
+		return suspend.Prune(pod)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return previous, nil
 }
 
-func startPod(namespace string, podname string, checks []bool) error {
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
+// upgradePodToLatest upgrades the containers of a pod on the registries to
+// the newest tags of their images.
+func upgradePodToLatest(user string, cluster string, namespace string, podname string) error {
+	pod, err := kubeclient.Get(cluster).Pods(namespace).Get(podname)
 	if err != nil {
 		return err
 	}
-
-	for i, check := range checks {
-		if pod.Spec.Containers[i].Image != PauseImage {
-			// Already started.
-			continue
-		}
-		if check {
-			paused := fmt.Sprintf("paused%d", i)
-			pod.Spec.Containers[i].Image = pod.Annotations[paused]
-			delete(pod.Annotations, paused)
-		}
+	var fullImages []string
+	upgrade := false
+	for _, container := range pod.Spec.Containers {
+		image := latestImage(container.Image)
+		fullImages = append(fullImages, image)
+		upgrade = upgrade || image != ""
+	}
+	if !upgrade {
+		glog.V(2).Infof("Pod '%s/%s' runs the latest images", namespace, podname)
+		return nil
 	}
+	_, err = setPodImage(user, "upgrade", cluster, namespace, podname, fullImages)
+	return err
+}
 
-	_, err = kubeclient.Get().Pods(namespace).Update(pod)
-	if err != nil {
-		return err
-	}
-	return nil
+// latestImage returns the newest tag of an image on a registry by the
+// version policy of its repository, or "" if it is the newest already or
+// not on a registry. Images whose tag is not listed are left alone, as they
+// can not be told older than the newest tag.
+func latestImage(fullImage string) string {
+	if _, _, ok := registry.Find(fullImage); !ok {
+		return ""
+	}
+	name, tag := splitImage(fullImage)
+	tags := getImageTags(registry.Short(name))
+	i := indexOf(tags, tag)
+	if i < 0 {
+		glog.Warningf("Skip upgrading %q: tag %q not found on the registry", fullImage, tag)
+		return ""
+	}
+	if i == len(tags)-1 {
+		return ""
+	}
+	return name + ":" + tags[len(tags)-1]
 }
 
-func syncPod(namespace string, podname string) error {
-	pod, err := kubeclient.Get().Pods(namespace).Get(podname)
-	if err != nil {
-		return err
-	}
-	rcname, ok := pod.Labels["managed-by"]
-	if !ok {
-		return fmt.Errorf("Need a `managed-by` label")
-	}
-	rc, err := kubeclient.Get().ReplicationControllers(namespace).Get(rcname)
-	if err != nil {
-		return err
-	}
-	nodeName := pod.Spec.NodeName
-	pod.Spec = rc.Spec.Template.Spec
-	pod.Spec.NodeName = nodeName
-	if pod.Annotations == nil {
-		pod.Annotations = make(map[string]string)
-	}
-	pod.Annotations["copied-from"] = rcname
-	for k, v := range rc.Spec.Template.Annotations {
-		if strings.HasPrefix(k, "config/") {
-			pod.Annotations[k] = v
+func stopPod(user string, cluster string, namespace string, podname string, checks []bool) error {
+	return modifyPod(user, "stop", cluster, namespace, podname, func(pod *api.Pod) error {
+		return suspend.Suspend(pod, checks, user, time.Now())
+	})
+}
+
+func startPod(user string, cluster string, namespace string, podname string, checks []bool) error {
+	return modifyPod(user, "start", cluster, namespace, podname, func(pod *api.Pod) error {
+		return suspend.Resume(pod, checks)
+	})
+}
+
+func syncPod(user string, cluster string, namespace string, podname string) error {
+	return modifyPod(user, "sync", cluster, namespace, podname, func(pod *api.Pod) error {
+		rcname, ok := pod.Labels["managed-by"]
+		if !ok {
+			return fmt.Errorf("Need a `managed-by` label")
 		}
-	}
-	_, err = kubeclient.Get().Pods(namespace).Update(pod)
-	return err
+		rc, err := kubeclient.Get(cluster).ReplicationControllers(namespace).Get(rcname)
+		if err != nil {
+			return err
+		}
+		nodeName := pod.Spec.NodeName
+		pod.Spec = rc.Spec.Template.Spec
+		pod.Spec.NodeName = nodeName
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		pod.Annotations["copied-from"] = rcname
+		copyConfigAnnotations(pod.Annotations, rc.Spec.Template.Annotations)
+		return suspend.Prune(pod)
+	})
 }
 
 func updatePod(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	podname := c.Param("po")
 	podjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
 	var pod api.Pod
 	err := json.Unmarshal([]byte(podjson), &pod)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &pod.ObjectMeta, namespace, podname) {
+		return
+	}
 
-	r, _ := kubeclient.Get().Pods(namespace).Get(pod.Name)
-	pod.ResourceVersion = r.ResourceVersion
-	_, err = kubeclient.Get().Pods(namespace).Update(&pod)
+	editURL := fmt.Sprintf("/clusters/%s/namespaces/%s/pods/%s/edit", cluster, namespace, podname)
+	target := podEditTarget(cluster, namespace, podname)
+	if !reviewEdit(c, target, podname, editURL, &pod) {
+		return
+	}
+	before, conflict, err := updateEdited(target, c.PostForm("original"), &pod)
+	if conflict != nil {
+		renderConflict(c, podname, editURL, conflict)
+		return
+	}
+	recordChange(signedInUser(c), "update", cluster, namespace, "Pod", podname, before, &pod, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s/pods/%s/edit", namespace, podname))
+	c.Redirect(http.StatusMovedPermanently, editURL)
 }
 
 func updateReplicationControllerWithPod(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	podname := c.Param("po")
 	podjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
 	var pod api.Pod
 	err := json.Unmarshal([]byte(podjson), &pod)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	rcname, ok := pod.Labels["managed-by"]
-	if !ok {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Need a `managed-by` label"})
+	if !checkTarget(c, &pod.ObjectMeta, namespace, podname) {
 		return
 	}
-	rc, err := kubeclient.Get().ReplicationControllers(namespace).Get(rcname)
-	if err != nil {
+	if err := exportPod(signedInUser(c), cluster, namespace, &pod); err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
-	nodeName := rc.Spec.Template.Spec.NodeName
-	rc.Spec.Template.Spec = pod.Spec
-	rc.Spec.Template.Spec.NodeName = nodeName
-	if rc.Annotations == nil {
-		rc.Annotations = make(map[string]string)
-	}
-	rc.Annotations["copied-from"] = podname
-	if rc.Spec.Template.Annotations == nil {
-		rc.Spec.Template.Annotations = make(map[string]string)
-	}
-	for k, v := range pod.Annotations {
-		if strings.HasPrefix(k, "config/") {
-			rc.Spec.Template.Annotations[k] = v
-		}
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/pods/%s/edit", cluster, namespace, podname))
+}
+
+// exportPod copies the spec and config/ annotations of the pod into the
+// template of the replication controller in its `managed-by` label. The
+// suspended containers are exported with the images they were running.
+func exportPod(user string, cluster string, namespace string, pod *api.Pod) error {
+	rcname, ok := pod.Labels["managed-by"]
+	if !ok {
+		return fmt.Errorf("Need a `managed-by` label")
 	}
-	_, err = kubeclient.Get().ReplicationControllers(namespace).Update(rc)
+	spec, _, err := runningSpec(pod)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
-		return
+		return err
 	}
-
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s/pods/%s/edit", namespace, podname))
+	return modifyReplicationController(user, "export", cluster, namespace, rcname, func(rc *api.ReplicationController) error {
+		nodeName := rc.Spec.Template.Spec.NodeName
+		rc.Spec.Template.Spec = spec
+		rc.Spec.Template.Spec.NodeName = nodeName
+		if rc.Annotations == nil {
+			rc.Annotations = make(map[string]string)
+		}
+		rc.Annotations["copied-from"] = pod.Name
+		if rc.Spec.Template.Annotations == nil {
+			rc.Spec.Template.Annotations = make(map[string]string)
+		}
+		copyConfigAnnotations(rc.Spec.Template.Annotations, pod.Annotations)
+		return nil
+	})
 }
 
 func updatePodWithReplicationController(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	podname := c.Param("po")
 
-	err := syncPod(namespace, podname)
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	err := syncPod(signedInUser(c), cluster, namespace, podname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s/pods/%s/edit", namespace, podname))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/pods/%s/edit", cluster, namespace, podname))
 }
 
 func updateReplicationController(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	rcname := c.Param("rc")
 	rcjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
 	var rc api.ReplicationController
 	err := json.Unmarshal([]byte(rcjson), &rc)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &rc.ObjectMeta, namespace, rcname) {
+		return
+	}
 
-	_, err = kubeclient.Get().ReplicationControllers(namespace).Update(&rc)
+	editURL := fmt.Sprintf("/clusters/%s/namespaces/%s/replicationcontrollers/%s/edit", cluster, namespace, rcname)
+	target := replicationControllerEditTarget(cluster, namespace, rcname)
+	if !reviewEdit(c, target, rcname, editURL, &rc) {
+		return
+	}
+	before, conflict, err := updateEdited(target, c.PostForm("original"), &rc)
+	if conflict != nil {
+		renderConflict(c, rcname, editURL, conflict)
+		return
+	}
+	recordChange(signedInUser(c), "update", cluster, namespace, "ReplicationController", rcname, before, &rc, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s/replicationcontrollers/%s/edit", namespace, rcname))
+	c.Redirect(http.StatusMovedPermanently, editURL)
 }
 
 func deleteReplicationController(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	rcname := c.Param("rc")
 
-	rc, err := kubeclient.Get().ReplicationControllers(namespace).Get(rcname)
+	if !authorize(c, namespace, auth.Manage) {
+		return
+	}
+
+	rc, err := kubeclient.Get(cluster).ReplicationControllers(namespace).Get(rcname)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
@@ -1407,16 +1727,18 @@ func deleteReplicationController(c *gin.Context) {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": "Replicas must be 0"})
 		return
 	}
-	err = kubeclient.Get().ReplicationControllers(namespace).Delete(rcname)
+	err = kubeclient.Get(cluster).ReplicationControllers(namespace).Delete(rcname)
+	recordChange(signedInUser(c), "delete", cluster, namespace, "ReplicationController", rcname, rc, nil, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s", namespace))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s", cluster, namespace))
 }
 
 func showReplicationControllerForm(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 
 	bytes, err := ioutil.ReadFile("replication-controller.json")
@@ -1426,6 +1748,7 @@ func showReplicationControllerForm(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "replicationControllerForm", gin.H{
+		"cluster":   cluster,
 		"title":     namespace,
 		"namespace": namespace,
 		"json":      string(bytes),
@@ -1433,15 +1756,23 @@ func showReplicationControllerForm(c *gin.Context) {
 }
 
 func createReplicationController(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	rcjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Manage) {
+		return
+	}
+
 	var rc api.ReplicationController
 	err := json.Unmarshal([]byte(rcjson), &rc)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &rc.ObjectMeta, namespace, "") {
+		return
+	}
 
 	if rc.Spec.Selector == nil {
 		rc.Spec.Selector = make(map[string]string)
@@ -1463,84 +1794,136 @@ func createReplicationController(c *gin.Context) {
 	}
 	rc.ObjectMeta = meta
 
-	_, err = kubeclient.Get().ReplicationControllers(namespace).Create(&rc)
+	_, err = kubeclient.Get(cluster).ReplicationControllers(namespace).Create(&rc)
+	recordChange(signedInUser(c), "create", cluster, namespace, "ReplicationController", rc.Name, nil, &rc, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s", namespace))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s", cluster, namespace))
 }
 
 func updateService(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	svcname := c.Param("svc")
 	svcjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
 	var svc api.Service
 	err := json.Unmarshal([]byte(svcjson), &svc)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &svc.ObjectMeta, namespace, svcname) {
+		return
+	}
 
-	_, err = kubeclient.Get().Services(namespace).Update(&svc)
+	editURL := fmt.Sprintf("/clusters/%s/namespaces/%s/services/%s/edit", cluster, namespace, svcname)
+	target := serviceEditTarget(cluster, namespace, svcname)
+	if !reviewEdit(c, target, svcname, editURL, &svc) {
+		return
+	}
+	before, conflict, err := updateEdited(target, c.PostForm("original"), &svc)
+	if conflict != nil {
+		renderConflict(c, svcname, editURL, conflict)
+		return
+	}
+	recordChange(signedInUser(c), "update", cluster, namespace, "Service", svcname, before, &svc, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s/services/%s/edit", namespace, svcname))
+	c.Redirect(http.StatusMovedPermanently, editURL)
 }
 
 func deleteService(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	svcname := c.Param("svc")
 
-	err := kubeclient.Get().Services(namespace).Delete(svcname)
+	if !authorize(c, namespace, auth.Manage) {
+		return
+	}
+
+	before, _ := kubeclient.Get(cluster).Services(namespace).Get(svcname)
+	err := kubeclient.Get(cluster).Services(namespace).Delete(svcname)
+	recordChange(signedInUser(c), "delete", cluster, namespace, "Service", svcname, before, nil, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s", namespace))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s", cluster, namespace))
 }
 
 func updateEndpoints(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	epname := c.Param("ep")
 	epjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
 	var ep api.Endpoints
 	err := json.Unmarshal([]byte(epjson), &ep)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &ep.ObjectMeta, namespace, epname) {
+		return
+	}
 
-	_, err = kubeclient.Get().Endpoints(namespace).Update(&ep)
+	editURL := fmt.Sprintf("/clusters/%s/namespaces/%s/endpoints/%s/edit", cluster, namespace, epname)
+	target := endpointsEditTarget(cluster, namespace, epname)
+	if !reviewEdit(c, target, epname, editURL, &ep) {
+		return
+	}
+	before, conflict, err := updateEdited(target, c.PostForm("original"), &ep)
+	if conflict != nil {
+		renderConflict(c, epname, editURL, conflict)
+		return
+	}
+	recordChange(signedInUser(c), "update", cluster, namespace, "Endpoints", epname, before, &ep, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s/endpoints/%s/edit", namespace, epname))
+	c.Redirect(http.StatusMovedPermanently, editURL)
 }
 
 func deleteEndpoints(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	epname := c.Param("ep")
 
-	err := kubeclient.Get().Endpoints(namespace).Delete(epname)
+	if !authorize(c, namespace, auth.Manage) {
+		return
+	}
+
+	before, _ := kubeclient.Get(cluster).Endpoints(namespace).Get(epname)
+	err := kubeclient.Get(cluster).Endpoints(namespace).Delete(epname)
+	recordChange(signedInUser(c), "delete", cluster, namespace, "Endpoints", epname, before, nil, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s", namespace))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s", cluster, namespace))
 }
 
 func showServiceForm(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 
 	bytes, err := ioutil.ReadFile("service.json")
@@ -1550,6 +1933,7 @@ func showServiceForm(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "serviceForm", gin.H{
+		"cluster":   cluster,
 		"title":     namespace,
 		"namespace": namespace,
 		"json":      string(bytes),
@@ -1557,55 +1941,87 @@ func showServiceForm(c *gin.Context) {
 }
 
 func createService(c *gin.Context) {
+	cluster := c.Param("cluster")
 	namespace := c.Param("ns")
 	svcjson := c.PostForm("json")
 
+	if !authorize(c, namespace, auth.Manage) {
+		return
+	}
+
 	var svc api.Service
 	err := json.Unmarshal([]byte(svcjson), &svc)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &svc.ObjectMeta, namespace, "") {
+		return
+	}
 
-	_, err = kubeclient.Get().Services(namespace).Create(&svc)
+	_, err = kubeclient.Get(cluster).Services(namespace).Create(&svc)
+	recordChange(signedInUser(c), "create", cluster, namespace, "Service", svc.Name, nil, &svc, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/namespaces/%s", namespace))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s", cluster, namespace))
 }
 
 func updateNode(c *gin.Context) {
+	cluster := c.Param("cluster")
 	nodename := c.Param("no")
 	nodejson := c.PostForm("json")
 
+	if !authorize(c, "", auth.Write) {
+		return
+	}
+
 	var node api.Node
 	err := json.Unmarshal([]byte(nodejson), &node)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
+	if !checkTarget(c, &node.ObjectMeta, "", nodename) {
+		return
+	}
 
-	r, _ := kubeclient.Get().Nodes().Get(node.Name)
-	node.ResourceVersion = r.ResourceVersion
-	_, err = kubeclient.Get().Nodes().Update(&node)
+	editURL := fmt.Sprintf("/clusters/%s/nodes/%s/edit", cluster, nodename)
+	target := nodeEditTarget(cluster, nodename)
+	if !reviewEdit(c, target, nodename, editURL, &node) {
+		return
+	}
+	before, conflict, err := updateEdited(target, c.PostForm("original"), &node)
+	if conflict != nil {
+		renderConflict(c, nodename, editURL, conflict)
+		return
+	}
+	recordChange(signedInUser(c), "update", cluster, "", "Node", nodename, before, &node, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/nodes/%s/edit", nodename))
+	c.Redirect(http.StatusMovedPermanently, editURL)
 }
 
 func deleteNode(c *gin.Context) {
+	cluster := c.Param("cluster")
 	nodename := c.Param("no")
 
-	err := kubeclient.Get().Nodes().Delete(nodename)
+	if !authorize(c, "", auth.Manage) {
+		return
+	}
+
+	before, _ := kubeclient.Get(cluster).Nodes().Get(nodename)
+	err := kubeclient.Get(cluster).Nodes().Delete(nodename)
+	recordChange(signedInUser(c), "delete", cluster, "", "Node", nodename, before, nil, err)
 	if err != nil {
 		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/nodes"))
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/nodes", cluster))
 }
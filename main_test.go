@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/jobs"
+	"github.com/aclisp/kubecon/pkg/page"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestOverview(t *testing.T) {
+	r, _ := setUp(t, testObjects()...)
+	w := request(r, "owner", "GET", "/clusters/test", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "rds") {
+		t.Errorf("got %d without the namespace rds: %s", w.Code, w.Body)
+	}
+
+	w = request(r, "owner", "GET", "/api/v1/clusters/test", nil)
+	var summary page.Summary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("got %d: %v", w.Code, err)
+	}
+	if len(summary.Namespaces) != 1 || summary.Namespaces[0].Name != "rds" || summary.Namespaces[0].PodCount != 1 {
+		t.Errorf("got namespaces %+v, want rds with 1 pod", summary.Namespaces)
+	}
+}
+
+func TestListPodsInNamespace(t *testing.T) {
+	r, _ := setUp(t, testObjects()...)
+	w := request(r, "operator", "GET", "/clusters/test/namespaces/rds/pods", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "web-1") {
+		t.Errorf("got %d without the pod web-1: %s", w.Code, w.Body)
+	}
+
+	w = request(r, "operator", "GET", "/clusters/test/namespaces/rds/pods?labelSelector=(", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad selector: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = request(r, "operator", "GET", "/api/v1/clusters/test/namespaces/rds/pods", nil)
+	var pods []page.Pod
+	if err := json.Unmarshal(w.Body.Bytes(), &pods); err != nil {
+		t.Fatalf("got %d: %v", w.Code, err)
+	}
+	if len(pods) != 1 || pods[0].Name != "web-1" || pods[0].Namespace != "rds" {
+		t.Errorf("got pods %+v, want rds/web-1", pods)
+	}
+}
+
+func TestDescribeNode(t *testing.T) {
+	r, _ := setUp(t, testObjects()...)
+	w := request(r, "owner", "GET", "/clusters/test/nodes/node-1", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "web-1") {
+		t.Errorf("got %d without the pod web-1: %s", w.Code, w.Body)
+	}
+
+	w = request(r, "owner", "GET", "/clusters/test/nodes/node-2", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unknown node: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestPerformPodsAction(t *testing.T) {
+	r, fake := setUp(t, testObjects()...)
+	form := url.Values{"action": {"stop"}, "pods": {`["web-1"]`}, "images": {`[]`}, "checks": {`[true]`}}
+	w := request(r, "operator", "POST", "/clusters/test/namespaces/rds/pods", form)
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("got %d, want %d: %s", w.Code, http.StatusMovedPermanently, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/jobs/") {
+		t.Fatalf("redirected to %q, want a job", location)
+	}
+	id := strings.TrimPrefix(location, "/jobs/")
+	id = id[:strings.Index(id+"?", "?")]
+
+	var job jobs.Job
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		job, _ = jobs.Get(id)
+		if job.State == jobs.Succeeded || job.State == jobs.Failed {
+			break
+		}
+	}
+	if job.State != jobs.Succeeded || job.User != "operator" {
+		t.Fatalf("got job %+v, want it succeeded for operator", job)
+	}
+	pod, err := fake.Pods("rds").Get("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := pod.Spec.Containers[0].Image; image != PauseImage {
+		t.Errorf("stopped container runs %q, want %q", image, PauseImage)
+	}
+
+	w = request(r, "operator", "POST", "/clusters/test/namespaces/rds/pods", url.Values{"action": {"stop"}, "pods": {"web-1"}})
+	if w.Code == http.StatusMovedPermanently {
+		t.Errorf("malformed pods: got %d", w.Code)
+	}
+}
+
+func TestCreateService(t *testing.T) {
+	r, fake := setUp(t, testObjects()...)
+	svc := api.Service{ObjectMeta: api.ObjectMeta{Name: "new", Namespace: "rds"}}
+	w := request(r, "owner", "POST", "/clusters/test/namespaces/rds/services", url.Values{"json": {toJSON(t, svc)}})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("got %d, want %d: %s", w.Code, http.StatusMovedPermanently, w.Body)
+	}
+	if got := writes(fake); !reflect.DeepEqual(got, []string{"create services"}) {
+		t.Errorf("got writes %v", got)
+	}
+	if _, err := fake.Services("rds").Get("new"); err != nil {
+		t.Errorf("service not created: %v", err)
+	}
+}
+
+func TestUpdateEndpointsAfterReview(t *testing.T) {
+	r, fake := setUp(t, testObjects()...)
+	ep := api.Endpoints{
+		ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: "rds"},
+		Subsets:    []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "10.0.0.1"}}}},
+	}
+	form := url.Values{"json": {toJSON(t, ep)}}
+
+	w := request(r, "operator", "POST", "/clusters/test/namespaces/rds/endpoints/svc/update", form)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Errorf("review: got %d without the change: %s", w.Code, w.Body)
+	}
+	if got := writes(fake); len(got) > 0 {
+		t.Errorf("review wrote %v", got)
+	}
+
+	form.Set("confirm", "true")
+	w = request(r, "operator", "POST", "/clusters/test/namespaces/rds/endpoints/svc/update", form)
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("got %d, want %d: %s", w.Code, http.StatusMovedPermanently, w.Body)
+	}
+	if got := writes(fake); !reflect.DeepEqual(got, []string{"update endpoints"}) {
+		t.Errorf("got writes %v", got)
+	}
+}
+
+func TestDeleteHandlers(t *testing.T) {
+	tests := []struct {
+		path  string
+		write string
+	}{
+		{"/clusters/test/namespaces/rds/services/svc/delete", "delete services"},
+		{"/clusters/test/namespaces/rds/endpoints/svc/delete", "delete endpoints"},
+		{"/clusters/test/namespaces/rds/replicationcontrollers/web/delete", "delete replicationcontrollers"},
+		{"/clusters/test/nodes/node-1/delete", "delete nodes"},
+	}
+	for _, test := range tests {
+		r, fake := setUp(t, testObjects()...)
+		w := request(r, "owner", "POST", test.path, url.Values{})
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("%s: got %d, want %d", test.path, w.Code, http.StatusMovedPermanently)
+		}
+		if got := writes(fake); !reflect.DeepEqual(got, []string{test.write}) {
+			t.Errorf("%s: got writes %v, want [%s]", test.path, got, test.write)
+		}
+	}
+}
+
+func TestDeleteReplicationControllerWithReplicas(t *testing.T) {
+	objects := testObjects()
+	for _, obj := range objects {
+		if rc, ok := obj.(*api.ReplicationController); ok {
+			rc.Spec.Replicas = 1
+		}
+	}
+	r, fake := setUp(t, objects...)
+	w := request(r, "owner", "POST", "/clusters/test/namespaces/rds/replicationcontrollers/web/delete", url.Values{})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if got := writes(fake); len(got) > 0 {
+		t.Errorf("got writes %v", got)
+	}
+}
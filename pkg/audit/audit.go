@@ -0,0 +1,228 @@
+// Package audit records who did what through kubecon into an append-only
+// JSON lines file, which is rotated when it grows too big.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/diff"
+	"github.com/golang/glog"
+)
+
+var (
+	// File is where the entries are appended. It is rotated to File.1,
+	// File.2 and so on when it grows over MaxSize bytes, keeping
+	// MaxBackups old files.
+	File             = "audit.log"
+	MaxSize    int64 = 100 * 1024 * 1024
+	MaxBackups       = 5
+
+	file     *os.File
+	fileSize int64
+	fileLock sync.Mutex
+)
+
+// ResultOK is the result of a successful action.
+const ResultOK = "ok"
+
+// Entry is one audited action of a user on an object.
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	User      string        `json:"user"`
+	Action    string        `json:"action"`
+	Cluster   string        `json:"cluster"`
+	Namespace string        `json:"namespace,omitempty"`
+	Kind      string        `json:"kind"`
+	Name      string        `json:"name"`
+	Detail    string        `json:"detail,omitempty"`
+	Changes   []diff.Change `json:"changes,omitempty"`
+	// Result is ResultOK or the error of the action.
+	Result string `json:"result"`
+}
+
+// Init opens File for appending. Without it the entries only go to the log.
+func Init() {
+	fileLock.Lock()
+	defer fileLock.Unlock()
+	if err := open(); err != nil {
+		glog.Errorf("Can not open audit log %q: %v", File, err)
+	}
+}
+
+func open() error {
+	f, err := os.OpenFile(File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	file, fileSize = f, info.Size()
+	return nil
+}
+
+// rotate renames File to File.1 after shifting the older backups.
+func rotate() error {
+	file.Close()
+	file = nil
+	os.Remove(backup(MaxBackups))
+	for i := MaxBackups - 1; i >= 1; i-- {
+		os.Rename(backup(i), backup(i+1))
+	}
+	if err := os.Rename(File, backup(1)); err != nil {
+		// Keep appending to the same file.
+		if err := open(); err != nil {
+			glog.Errorf("Can not reopen audit log %q: %v", File, err)
+		}
+		return err
+	}
+	return open()
+}
+
+func backup(i int) string {
+	return fmt.Sprintf("%s.%d", File, i)
+}
+
+// Record appends e to File, with the current time if it has none.
+func Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Result == "" {
+		e.Result = ResultOK
+	}
+	glog.Infof("AUDIT %s %s %s/%s/%s/%s %s: %s", e.User, e.Action, e.Cluster, e.Namespace, e.Kind, e.Name, e.Detail, e.Result)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		glog.Errorf("Can not marshal audit entry: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	fileLock.Lock()
+	defer fileLock.Unlock()
+	if file == nil {
+		return
+	}
+	if fileSize+int64(len(data)) > MaxSize && fileSize > 0 {
+		if err := rotate(); err != nil {
+			glog.Errorf("Can not rotate audit log %q: %v", File, err)
+			if file == nil {
+				return
+			}
+		}
+	}
+	n, err := file.Write(data)
+	fileSize += int64(n)
+	if err != nil {
+		glog.Errorf("Can not write audit log %q: %v", File, err)
+	}
+}
+
+// Filter selects entries, every non-empty field must match.
+type Filter struct {
+	User      string
+	Cluster   string
+	Namespace string
+	Action    string
+	// Visible hides the entries a reader is not allowed to see.
+	Visible func(e *Entry) bool
+}
+
+func (f Filter) match(e *Entry) bool {
+	return (f.User == "" || f.User == e.User) &&
+		(f.Cluster == "" || f.Cluster == e.Cluster) &&
+		(f.Namespace == "" || f.Namespace == e.Namespace) &&
+		(f.Action == "" || f.Action == e.Action) &&
+		(f.Visible == nil || f.Visible(e))
+}
+
+// Read returns up to limit entries matching filter, newest first. It reads
+// File and then its backups from their ends, and stops as soon as it has
+// enough.
+func Read(filter Filter, limit int) ([]Entry, error) {
+	var result []Entry
+	for i := 0; i <= MaxBackups && len(result) < limit; i++ {
+		name := File
+		if i > 0 {
+			name = backup(i)
+		}
+		entries, err := readFile(name, filter, limit-len(result))
+		if os.IsNotExist(err) {
+			break
+		}
+		result = append(result, entries...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// readChunk is how much of a file readFile reads at once.
+const readChunk = 64 * 1024
+
+// readFile returns up to limit entries of the file matching filter, the
+// last ones first. The file is read backwards in chunks, so that only the
+// lines needed are decoded.
+func readFile(name string, filter Filter, limit int) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	// rest is the beginning of a line whose start is not read yet.
+	var rest []byte
+	for end := info.Size(); end > 0 && len(entries) < limit; {
+		start := end - readChunk
+		if start < 0 {
+			start = 0
+		}
+		chunk := make([]byte, end-start, int(end-start)+len(rest))
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return entries, err
+		}
+		chunk = append(chunk, rest...)
+		end = start
+
+		lines := bytes.Split(chunk, []byte{'\n'})
+		if start > 0 {
+			// The first line may go on in the previous chunk.
+			rest, lines = lines[0], lines[1:]
+		} else {
+			rest = nil
+		}
+		for j := len(lines) - 1; j >= 0 && len(entries) < limit; j-- {
+			if e, ok := decodeLine(name, lines[j]); ok && filter.match(&e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func decodeLine(name string, line []byte) (Entry, bool) {
+	var e Entry
+	if len(bytes.TrimSpace(line)) == 0 {
+		return e, false
+	}
+	if err := json.Unmarshal(line, &e); err != nil {
+		glog.Warningf("Skip bad audit entry in %q: %v", name, err)
+		return e, false
+	}
+	return e, true
+}
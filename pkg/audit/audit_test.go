@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadNewestFirstAcrossBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	File = filepath.Join(dir, "audit.log")
+	MaxSize = 4096
+	Init()
+	defer func() {
+		file.Close()
+		file = nil
+	}()
+
+	// Long details make the lines span several chunks and files.
+	detail := strings.Repeat("x", 300)
+	for i := 0; i < 100; i++ {
+		user := "alice"
+		if i%2 == 1 {
+			user = "bob"
+		}
+		Record(Entry{User: user, Action: "update", Name: fmt.Sprint(i), Detail: detail})
+	}
+	if _, err := os.Stat(backup(1)); err != nil {
+		t.Fatalf("audit log not rotated: %v", err)
+	}
+
+	tests := []struct {
+		filter Filter
+		limit  int
+		want   []string
+	}{
+		{Filter{}, 3, []string{"99", "98", "97"}},
+		{Filter{User: "alice"}, 3, []string{"98", "96", "94"}},
+		{Filter{User: "carol"}, 3, nil},
+	}
+	for _, test := range tests {
+		entries, err := Read(test.filter, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name)
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%+v: got %v, want %v", test.filter, got, test.want)
+		}
+	}
+
+	// The backups are read once the newest file runs out.
+	entries, err := Read(Filter{}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if want := fmt.Sprint(99 - i); e.Name != want {
+			t.Fatalf("entry %d is %s, want %s", i, e.Name, want)
+		}
+	}
+	if len(entries) == 0 || len(entries) >= 100 {
+		t.Errorf("got %d entries, want those of %d files", len(entries), MaxBackups+1)
+	}
+}
+
+func TestReadFileAcrossChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "audit.log")
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf(`{"name":"%d","detail":"%s"}`, i, strings.Repeat("y", i)))
+	}
+	// A bad line is skipped.
+	lines = append(lines, "not json")
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readFile(name, Filter{}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 500 {
+		t.Fatalf("got %d entries, want 500", len(entries))
+	}
+	for i, e := range entries {
+		if want := fmt.Sprint(499 - i); e.Name != want || len(e.Detail) != 499-i {
+			t.Fatalf("entry %d is %s with %d bytes, want %s", i, e.Name, len(e.Detail), want)
+		}
+	}
+}
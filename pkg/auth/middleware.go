@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+var (
+	users      *Store
+	policy     *Policy
+	UsersFile  = "users.htpasswd"
+	PolicyFile = "policy.json"
+
+	// verified caches the successful credentials because bcrypt is slow
+	// by design and every page load would pay for it. The keys include the
+	// stored hash, so a removed user or a changed password misses.
+	verified     = make(map[[sha256.Size]byte]bool)
+	verifiedLock sync.Mutex
+)
+
+// maxVerified bounds verified, which is emptied when it is full.
+const maxVerified = 1024
+
+// Init loads the users and the role bindings. Missing files leave kubecon
+// with no users, so that every request is rejected.
+func Init() {
+	var err error
+	if users, err = LoadStore(UsersFile); err != nil {
+		glog.Warningf("Can not load users from %q: %v", UsersFile, err)
+		users = &Store{users: make(map[string]User)}
+	} else {
+		glog.Infof("Loaded %d users from %q", users.Len(), UsersFile)
+	}
+	verifiedLock.Lock()
+	verified = make(map[[sha256.Size]byte]bool)
+	verifiedLock.Unlock()
+	if policy, err = LoadPolicy(PolicyFile); err != nil {
+		glog.Warningf("Can not load policy from %q: %v", PolicyFile, err)
+		policy = &Policy{}
+	} else {
+		glog.Infof("Loaded %d role bindings from %q", len(policy.Bindings), PolicyFile)
+	}
+}
+
+// Allowed tells if the user can perform verb in namespace of cluster
+// according to the loaded policy.
+func Allowed(user string, cluster string, namespace string, verb Verb) bool {
+	if policy == nil {
+		glog.Fatalf("Forget to call auth.Init()?")
+	}
+	return policy.Allowed(user, cluster, namespace, verb)
+}
+
+func authenticate(name string, password string) bool {
+	hash, ok := users.Hash(name)
+	if !ok {
+		return false
+	}
+	key := sha256.Sum256([]byte(name + ":" + hash + ":" + password))
+	verifiedLock.Lock()
+	ok = verified[key]
+	verifiedLock.Unlock()
+	if ok {
+		return true
+	}
+	if !users.Authenticate(name, password) {
+		return false
+	}
+	verifiedLock.Lock()
+	if len(verified) >= maxVerified {
+		verified = make(map[[sha256.Size]byte]bool)
+	}
+	verified[key] = true
+	verifiedLock.Unlock()
+	return true
+}
+
+// Scope is the cluster and namespace a request works on. An empty
+// namespace stands for the cluster scope.
+type Scope struct {
+	Cluster   string
+	Namespace string
+}
+
+// ScopeFunc returns the scope of a request. It returns false for the pages
+// which every signed in user can read.
+type ScopeFunc func(c *gin.Context) (scope Scope, ok bool)
+
+// Middleware authenticates the request with HTTP basic auth, sets the user
+// name to gin.AuthUserKey, then checks the user's role in the scope of the
+// request. GET requests need Read and all others need Write.
+func Middleware(scope ScopeFunc) gin.HandlerFunc {
+	realm := "Basic realm=" + strconv.Quote("Sigma")
+	return func(c *gin.Context) {
+		user, password, ok := c.Request.BasicAuth()
+		if !ok || !authenticate(user, password) {
+			c.Header("WWW-Authenticate", realm)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set(gin.AuthUserKey, user)
+
+		target, ok := scope(c)
+		if !ok {
+			return
+		}
+		verb := Write
+		if c.Request.Method == "GET" || c.Request.Method == "HEAD" {
+			verb = Read
+		}
+		if !Allowed(user, target.Cluster, target.Namespace, verb) {
+			glog.Warningf("Denied %s %s to user %q", c.Request.Method, c.Request.URL.Path, user)
+			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			} else {
+				c.HTML(http.StatusForbidden, "error", gin.H{"error": "Forbidden"})
+			}
+			c.Abort()
+		}
+	}
+}
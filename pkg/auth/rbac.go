@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Role is a named set of verbs a user may perform in a namespace.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// Verb is the kind of access requested on a namespace.
+type Verb string
+
+const (
+	// Read allows to view pages, logs and object descriptions.
+	Read Verb = "read"
+	// Write allows to update objects and to run pod actions.
+	Write Verb = "write"
+	// Manage allows to create and delete objects.
+	Manage Verb = "manage"
+)
+
+// AllNamespaces binds a role to every namespace and to the cluster scoped
+// objects such as nodes. AllClusters binds it in every cluster.
+const (
+	AllNamespaces = "*"
+	AllClusters   = "*"
+)
+
+var roleVerbs = map[Role][]Verb{
+	RoleViewer:   {Read},
+	RoleOperator: {Read, Write},
+	RoleAdmin:    {Read, Write, Manage},
+}
+
+// Binding grants a role to a user in a namespace. An empty cluster means
+// all clusters.
+type Binding struct {
+	User      string `json:"user"`
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Role      Role   `json:"role"`
+}
+
+// Policy is the set of role bindings.
+type Policy struct {
+	Bindings []Binding `json:"bindings"`
+}
+
+// LoadPolicy reads role bindings from a JSON file.
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, err
+	}
+	for _, b := range policy.Bindings {
+		if _, ok := roleVerbs[b.Role]; !ok {
+			return nil, fmt.Errorf("Unknown role %q bound to user %q", b.Role, b.User)
+		}
+		if b.Namespace == "" {
+			return nil, fmt.Errorf("Empty namespace bound to user %q", b.User)
+		}
+	}
+	return policy, nil
+}
+
+// Allowed tells if the user can perform verb in namespace of cluster. An
+// empty namespace stands for the cluster scope, which needs a binding on
+// all namespaces.
+func (p *Policy) Allowed(user string, cluster string, namespace string, verb Verb) bool {
+	for _, b := range p.Bindings {
+		if b.User != user {
+			continue
+		}
+		if b.Cluster != "" && b.Cluster != AllClusters && b.Cluster != cluster {
+			continue
+		}
+		if b.Namespace != AllNamespaces && b.Namespace != namespace {
+			continue
+		}
+		for _, v := range roleVerbs[b.Role] {
+			if v == verb {
+				return true
+			}
+		}
+	}
+	return false
+}
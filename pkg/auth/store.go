@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/golang/glog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an account which can sign in to kubecon.
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"` // bcrypt or {SHA} hash, never plain text
+}
+
+// Store holds the known users indexed by name.
+type Store struct {
+	users map[string]User
+}
+
+// LoadStore reads users from either a JSON file (a list of User) or an
+// htpasswd file created by `htpasswd -B` or `htpasswd -s`.
+func LoadStore(filename string) (*Store, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	if strings.HasSuffix(filename, ".json") {
+		if err := json.Unmarshal(data, &users); err != nil {
+			return nil, err
+		}
+	} else {
+		if users, err = parseHtpasswd(data); err != nil {
+			return nil, err
+		}
+	}
+	store := &Store{users: make(map[string]User)}
+	for _, user := range users {
+		if user.Name == "" {
+			return nil, fmt.Errorf("User can not be empty")
+		}
+		if !isHashed(user.Password) {
+			return nil, fmt.Errorf("Password of user %q is not hashed", user.Name)
+		}
+		store.users[user.Name] = user
+	}
+	return store, nil
+}
+
+func parseHtpasswd(data []byte) (users []User, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		splits := strings.SplitN(line, ":", 2)
+		if len(splits) != 2 {
+			return nil, fmt.Errorf("Malformed htpasswd line %d", lineno)
+		}
+		users = append(users, User{Name: splits[0], Password: splits[1]})
+	}
+	return users, scanner.Err()
+}
+
+func isHashed(password string) bool {
+	return strings.HasPrefix(password, "$2") || strings.HasPrefix(password, "{SHA}")
+}
+
+// Authenticate checks the password of the named user.
+func (s *Store) Authenticate(name string, password string) bool {
+	user, ok := s.users[name]
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(user.Password, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		given := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(given), []byte(user.Password)) == 1
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil && err != bcrypt.ErrMismatchedHashAndPassword {
+		glog.Warningf("Can not verify password of user %q: %v", name, err)
+	}
+	return err == nil
+}
+
+// Hash returns the stored password hash of the named user.
+func (s *Store) Hash(name string) (string, bool) {
+	user, ok := s.users[name]
+	return user.Password, ok
+}
+
+// Len returns the number of users.
+func (s *Store) Len() int {
+	return len(s.users)
+}
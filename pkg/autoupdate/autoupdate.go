@@ -0,0 +1,309 @@
+// Package autoupdate watches the replication controllers which opt in with
+// RangeAnnotation on their templates, and upgrades them to the newer tags
+// of their images in the range, either at once or when someone approves.
+// Every decision is kept in a JSON file.
+package autoupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// RangeAnnotation on the template of a replication controller is the
+	// range of the versions its images are upgraded to, such as "~1.2".
+	RangeAnnotation = "kubecon/auto-update"
+	// ModeAnnotation is ModeApprove, the default, or ModeAuto.
+	ModeAnnotation = "kubecon/auto-update-mode"
+
+	// ModeApprove opens a pending update for someone to approve.
+	ModeApprove = "approve"
+	// ModeAuto applies the updates at once.
+	ModeAuto = "auto"
+
+	// User makes the automatic decisions.
+	User = "auto-update"
+)
+
+// The states of an update.
+const (
+	Pending  = "Pending"
+	Applying = "Applying"
+	Applied  = "Applied"
+	Failed   = "Failed"
+	Rejected = "Rejected"
+	// Superseded is an open update replaced by one to another tag.
+	Superseded = "Superseded"
+)
+
+var (
+	// File keeps all the updates.
+	File = "autoupdates.json"
+	// Interval is how often the registries are polled.
+	Interval = 5 * time.Minute
+	// MaxUpdates is how many decided updates are kept.
+	MaxUpdates = 500
+
+	updates []*Update
+	lock    sync.Mutex
+	seq     int
+	finder  Finder
+	applier Applier
+	wake    = make(chan struct{}, 1)
+)
+
+// Update upgrades the container Index of the template of a replication
+// controller, and its pods, from the image From to To.
+type Update struct {
+	ID                    string    `json:"id"`
+	Cluster               string    `json:"cluster"`
+	Namespace             string    `json:"namespace"`
+	ReplicationController string    `json:"replicationController"`
+	Container             string    `json:"container"`
+	Index                 int       `json:"index"`
+	From                  string    `json:"from"`
+	To                    string    `json:"to"`
+	Range                 string    `json:"range"`
+	Mode                  string    `json:"mode"`
+	State                 string    `json:"state"`
+	Found                 time.Time `json:"found"`
+	// Decided is when User approved, rejected or superseded the update,
+	// or when it was applied automatically.
+	Decided time.Time `json:"decided,omitempty"`
+	User    string    `json:"user,omitempty"`
+	// Job upgrades the pods, if there are any.
+	Job   string `json:"job,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Open tells if the update waits for a decision.
+func (u *Update) Open() bool {
+	return u.State == Pending || u.State == Failed
+}
+
+// same tells if both update the same container.
+func (u *Update) same(o *Update) bool {
+	return u.Cluster == o.Cluster && u.Namespace == o.Namespace && u.ReplicationController == o.ReplicationController && u.Index == o.Index
+}
+
+// Finder returns the updates the replication controllers could have now,
+// with their Mode.
+type Finder func() []Update
+
+// Applier upgrades as user, and returns the job upgrading the pods.
+type Applier func(u Update, user string) (job string, err error)
+
+// Init loads the updates from File, and starts polling every Interval with
+// find. The updates being applied when kubecon stopped are failed.
+func Init(find Finder, apply Applier) {
+	finder, applier = find, apply
+	data, err := ioutil.ReadFile(File)
+	if err != nil && !os.IsNotExist(err) {
+		glog.Errorf("Can not read updates %q: %v", File, err)
+	}
+	var list []*Update
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &list); err != nil {
+			glog.Errorf("Can not decode updates %q: %v", File, err)
+		}
+	}
+
+	lock.Lock()
+	for _, u := range list {
+		if u.State == Applying {
+			u.State = Failed
+			u.Error = "Interrupted, kubecon was not running"
+		}
+	}
+	updates = list
+	save()
+	lock.Unlock()
+	glog.Infof("Loaded %d updates from %q", len(list), File)
+
+	go loop()
+}
+
+func loop() {
+	for {
+		check()
+		select {
+		case <-time.After(Interval):
+		case <-wake:
+		}
+	}
+}
+
+// CheckNow polls the registries in the background, without waiting for
+// Interval.
+func CheckNow() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// check decides what to do with every update found.
+func check() {
+	for _, u := range finder() {
+		decide(u)
+	}
+}
+
+// decide opens the update found, or applies it if its mode is ModeAuto. An
+// update found before is left alone, and the open ones to other tags are
+// superseded.
+func decide(found Update) {
+	now := time.Now()
+	lock.Lock()
+	for _, u := range updates {
+		if u.same(&found) && u.To == found.To && u.From == found.From {
+			lock.Unlock()
+			return
+		}
+	}
+	for _, u := range updates {
+		if u.same(&found) && u.Open() {
+			u.State, u.Decided, u.User = Superseded, now, User
+		}
+	}
+	seq++
+	u := found
+	u.ID = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), seq)
+	u.Found = now
+	u.State = Pending
+	if u.Mode == ModeAuto {
+		u.State = Applying
+	}
+	add(&u)
+	save()
+	lock.Unlock()
+
+	glog.Infof("Found update %s of '%s/%s/%s': %s -> %s (%s)", u.ID, u.Cluster, u.Namespace, u.ReplicationController, u.From, u.To, u.Mode)
+	if u.Mode == ModeAuto {
+		apply(u, User)
+	}
+}
+
+// add puts an update first, dropping the oldest decided ones over
+// MaxUpdates. The caller holds lock.
+func add(u *Update) {
+	updates = append([]*Update{u}, updates...)
+	for i := len(updates) - 1; i >= 0 && len(updates) > MaxUpdates; i-- {
+		if !updates[i].Open() && updates[i].State != Applying {
+			updates = append(updates[:i], updates[i+1:]...)
+		}
+	}
+}
+
+// apply applies the update, which is Applying, as user and records the
+// result.
+func apply(u Update, user string) {
+	job, err := applier(u, user)
+	lock.Lock()
+	defer lock.Unlock()
+	current := find(u.ID)
+	if current == nil {
+		return
+	}
+	current.State, current.Decided, current.User, current.Job, current.Error = Applied, time.Now(), user, job, ""
+	if err != nil {
+		glog.Warningf("Update %s failed: %v", u.ID, err)
+		current.State, current.Error = Failed, err.Error()
+	}
+	save()
+}
+
+// find returns the update by ID. The caller holds lock.
+func find(id string) *Update {
+	for _, u := range updates {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// Approve applies a pending or failed update as user.
+func Approve(id string, user string) error {
+	lock.Lock()
+	u := find(id)
+	if u == nil {
+		lock.Unlock()
+		return fmt.Errorf("Update %q not found", id)
+	}
+	if !u.Open() {
+		lock.Unlock()
+		return fmt.Errorf("Update %q is %s", id, u.State)
+	}
+	u.State = Applying
+	save()
+	approved := *u
+	lock.Unlock()
+
+	apply(approved, user)
+	if u, ok := Get(id); ok && u.State == Failed {
+		return fmt.Errorf("%s", u.Error)
+	}
+	return nil
+}
+
+// Reject closes a pending or failed update as user, so that it is not
+// found again.
+func Reject(id string, user string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	u := find(id)
+	if u == nil {
+		return fmt.Errorf("Update %q not found", id)
+	}
+	if !u.Open() {
+		return fmt.Errorf("Update %q is %s", id, u.State)
+	}
+	u.State, u.Decided, u.User = Rejected, time.Now(), user
+	return save()
+}
+
+// Get returns a copy of the update.
+func Get(id string) (Update, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	if u := find(id); u != nil {
+		return *u, true
+	}
+	return Update{}, false
+}
+
+// List returns the updates for which visible returns true, newest first.
+func List(visible func(u *Update) bool) (result []Update) {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, u := range updates {
+		if visible == nil || visible(u) {
+			result = append(result, *u)
+		}
+	}
+	return
+}
+
+// save writes all the updates to File. The caller holds lock.
+func save() error {
+	data, err := json.MarshalIndent(updates, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(File+".tmp", data, 0640); err != nil {
+		glog.Errorf("Can not save updates: %v", err)
+		return err
+	}
+	if err := os.Rename(File+".tmp", File); err != nil {
+		glog.Errorf("Can not save updates: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package autoupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecideApproveReject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autoupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	File = filepath.Join(dir, "autoupdates.json")
+	updates = nil
+	var applied []string
+	applier = func(u Update, user string) (string, error) {
+		if u.To == "web:broken" {
+			return "", fmt.Errorf("broken")
+		}
+		applied = append(applied, user+" "+u.To)
+		return "job-" + u.To, nil
+	}
+
+	web := Update{Cluster: "test", Namespace: "rds", ReplicationController: "web", Index: 0, From: "web:1.0.0", Mode: ModeApprove}
+	found := func(to string) Update {
+		u := web
+		u.To = to
+		return u
+	}
+	latest := func() Update {
+		list := List(nil)
+		if len(list) == 0 {
+			t.Fatal("no updates")
+		}
+		return list[0]
+	}
+
+	decide(found("web:1.0.1"))
+	first := latest()
+	if first.State != Pending {
+		t.Fatalf("got %+v, want it pending", first)
+	}
+	// Found again, it is decided once.
+	decide(found("web:1.0.1"))
+	if n := len(List(nil)); n != 1 {
+		t.Fatalf("got %d updates, want 1", n)
+	}
+
+	// A newer tag supersedes the open update.
+	decide(found("web:1.0.2"))
+	second := latest()
+	if u, _ := Get(first.ID); u.State != Superseded || u.User != User {
+		t.Errorf("got %+v, want it superseded", u)
+	}
+	if err := Approve(first.ID, "alice"); err == nil {
+		t.Error("approving a superseded update: got no error")
+	}
+
+	if err := Reject(second.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := Get(second.ID); u.State != Rejected || u.User != "alice" || u.Decided.IsZero() {
+		t.Errorf("got %+v, want it rejected by alice", u)
+	}
+	// A rejected update is not proposed again.
+	decide(found("web:1.0.2"))
+	if n := len(List(nil)); n != 2 {
+		t.Errorf("got %d updates, want 2", n)
+	}
+	if err := Reject(second.ID, "alice"); err == nil {
+		t.Error("rejecting twice: got no error")
+	}
+
+	decide(found("web:broken"))
+	broken := latest()
+	if err := Approve(broken.ID, "alice"); err == nil {
+		t.Error("approving a failing update: got no error")
+	}
+	if u, _ := Get(broken.ID); u.State != Failed || u.Error != "broken" {
+		t.Errorf("got %+v, want it failed", u)
+	}
+
+	decide(found("web:1.0.3"))
+	pending := latest()
+	if u, _ := Get(broken.ID); u.State != Superseded {
+		t.Errorf("got %+v, want the failed update superseded", u)
+	}
+	if err := Approve(pending.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := Get(pending.ID); u.State != Applied || u.User != "alice" || u.Job != "job-web:1.0.3" {
+		t.Errorf("got %+v, want it applied by alice", u)
+	}
+
+	auto := found("web:1.0.4")
+	auto.Mode = ModeAuto
+	decide(auto)
+	if u := latest(); u.State != Applied || u.User != User {
+		t.Errorf("got %+v, want it applied by %s", u, User)
+	}
+	if want := []string{"alice web:1.0.3", User + " web:1.0.4"}; fmt.Sprint(applied) != fmt.Sprint(want) {
+		t.Errorf("applied %v, want %v", applied, want)
+	}
+
+	if err := Approve("missing", "alice"); err == nil {
+		t.Error("approving a missing update: got no error")
+	}
+
+	// Every decision is saved.
+	data, err := ioutil.ReadFile(File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []Update
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 5 || saved[0].To != "web:1.0.4" || saved[0].State != Applied {
+		t.Errorf("saved %+v", saved)
+	}
+}
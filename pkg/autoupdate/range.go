@@ -0,0 +1,117 @@
+package autoupdate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+// ParseRange parses a range of versions, such as "~1.2", "^1.2.3", "1.x",
+// ">=1.2 <2" or "*". The comparators of semver.ParseRange are taken with
+// partial versions, which stand for all their versions: ">1.2" is ">=1.3.0"
+// and "<=1.2" is "<1.3.0". The ranges are joined by "||".
+func ParseRange(s string) (semver.Range, error) {
+	var parts []string
+	for _, field := range strings.Fields(s) {
+		if field == "||" {
+			parts = append(parts, field)
+			continue
+		}
+		part, err := expandRange(field)
+		if err != nil {
+			return nil, fmt.Errorf("Bad range %q: %v", s, err)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("Empty range")
+	}
+	return semver.ParseRange(strings.Join(parts, " "))
+}
+
+// expandRange turns a field of a range into the comparators of
+// semver.ParseRange.
+func expandRange(field string) (string, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", "==", ">", "<", "=", "!", "~", "^"} {
+		if strings.HasPrefix(field, prefix) {
+			op, field = prefix, field[len(prefix):]
+			break
+		}
+	}
+	nums, err := partialVersion(strings.TrimPrefix(field, "v"))
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(nums) == 0:
+		// "*" or "x" takes every version.
+		if op != "" && op != "=" && op != "==" {
+			return "", fmt.Errorf("%q needs a version", op)
+		}
+		return ">=0.0.0", nil
+	case op == "~":
+		if len(nums) == 1 {
+			return between(nums, []int{nums[0] + 1, 0, 0}), nil
+		}
+		return between(nums, []int{nums[0], nums[1] + 1, 0}), nil
+	case op == "^":
+		switch {
+		case nums[0] > 0 || len(nums) == 1:
+			return between(nums, []int{nums[0] + 1, 0, 0}), nil
+		case len(nums) == 2 || nums[1] > 0:
+			return between(nums, []int{0, nums[1] + 1, 0}), nil
+		default:
+			return between(nums, []int{0, 0, nums[2] + 1}), nil
+		}
+	case len(nums) < 3 && (op == "" || op == "=" || op == "=="):
+		// "1.2" and "1.2.x" take every patch of 1.2.
+		return between(nums, after(nums)), nil
+	case len(nums) < 3 && op == ">":
+		return ">=" + version(after(nums)), nil
+	case len(nums) < 3 && op == "<=":
+		return "<" + version(after(nums)), nil
+	}
+	return op + version(nums), nil
+}
+
+// after returns the first version after all those of a partial version.
+func after(nums []int) []int {
+	if len(nums) == 1 {
+		return []int{nums[0] + 1, 0, 0}
+	}
+	return []int{nums[0], nums[1] + 1, 0}
+}
+
+// partialVersion parses "1", "1.2", "1.2.3" and their "x" or "*" forms.
+// Anything after the patch, such as a pre-release, is not supported.
+func partialVersion(s string) ([]int, error) {
+	var nums []int
+	for i, part := range strings.Split(s, ".") {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || i > 2 {
+			return nil, fmt.Errorf("Bad version %q", s)
+		}
+		nums = append(nums, n)
+	}
+	return nums, nil
+}
+
+func between(lower []int, upper []int) string {
+	return ">=" + version(lower) + " <" + version(upper)
+}
+
+// version pads a partial version with zeros.
+func version(nums []int) string {
+	parts := []string{"0", "0", "0"}
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,58 @@
+package autoupdate
+
+import (
+	"testing"
+
+	"github.com/blang/semver"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		spec string
+		in   []string
+		out  []string
+	}{
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.1.9", "1.3.0"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+		{"^1.2", []string{"1.2.0", "1.9.0"}, []string{"1.1.9", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.2.2", "0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+		{"1.2.x", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{">1.2", []string{"1.3.0", "2.0.0"}, []string{"1.2.0", "1.2.5"}},
+		{">1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{">=1.2 <2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{"<=1.2", []string{"1.0.0", "1.2.5"}, []string{"1.3.0"}},
+		{"<=1", []string{"1.9.9"}, []string{"2.0.0"}},
+		{"<1.2", []string{"1.1.9"}, []string{"1.2.0"}},
+		{"1.2 || 1.4", []string{"1.2.3", "1.4.0"}, []string{"1.3.0", "1.5.0"}},
+		{"~1.2 || >=2.1 <3", []string{"1.2.1", "2.5.0"}, []string{"2.0.0", "3.0.0"}},
+		{"*", []string{"0.0.0", "9.9.9"}, nil},
+		{"v1.2", []string{"1.2.1"}, []string{"1.3.0"}},
+	}
+	for _, test := range tests {
+		r, err := ParseRange(test.spec)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		for _, v := range test.in {
+			if !r(semver.MustParse(v)) {
+				t.Errorf("%q does not take %s", test.spec, v)
+			}
+		}
+		for _, v := range test.out {
+			if r(semver.MustParse(v)) {
+				t.Errorf("%q takes %s", test.spec, v)
+			}
+		}
+	}
+
+	for _, spec := range []string{"", "~", ">*", "1.2.3.4", "abc", "~1.a"} {
+		if _, err := ParseRange(spec); err == nil {
+			t.Errorf("%q: got no error", spec)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package cli is the command line client of kubecon. It runs the same pod
+// actions as the pages through the JSON API of a kubecon server.
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	client = &Client{}
+	output string
+)
+
+// NewCommand returns the root command of the client.
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "kubecon",
+		Short:        "kubecon manages the pods of Sigma from the command line",
+		SilenceUsage: true,
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&client.Server, "server", envOr("KUBECON_SERVER", "https://127.0.0.1:8080"), "The address of the kubecon server, or $KUBECON_SERVER")
+	flags.StringVar(&client.Cluster, "cluster", envOr("KUBECON_CLUSTER", "default"), "The cluster to work on, or $KUBECON_CLUSTER")
+	flags.StringVarP(&client.Username, "user", "u", envOr("KUBECON_USER", ""), "The user to sign in as, or $KUBECON_USER")
+	flags.StringVar(&client.Password, "password", os.Getenv("KUBECON_PASSWORD"), "The password of the user, or $KUBECON_PASSWORD")
+	flags.BoolVar(&client.Insecure, "insecure-skip-tls-verify", false, "Do not verify the certificate of the server, which is self-signed by default")
+	flags.DurationVar(&client.Timeout, "timeout", 30*time.Second, "The timeout of each request to the server")
+	flags.StringVarP(&output, "output", "o", "table", "The output format, table or json")
+	cmd.AddCommand(newPodsCommand())
+	return cmd
+}
+
+func envOr(key string, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+// printJSON writes v indented, for -o json.
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to the JSON API of a kubecon server.
+type Client struct {
+	Server   string
+	Cluster  string
+	Username string
+	Password string
+	Insecure bool
+	// Timeout limits each request, so that a hung server does not block
+	// the commands.
+	Timeout time.Duration
+}
+
+// apiError is how the API reports failures.
+type apiError struct {
+	Error  string   `json:"error"`
+	Errors []string `json:"errors"`
+}
+
+func (c *Client) httpClient() *http.Client {
+	client := &http.Client{Timeout: c.Timeout}
+	if c.Insecure {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return client
+}
+
+// path returns the API path of a resource in the cluster.
+func (c *Client) path(format string, args ...interface{}) string {
+	return strings.TrimSuffix(c.Server, "/") + "/api/v1/clusters/" + c.Cluster + fmt.Sprintf(format, args...)
+}
+
+// do sends in as the JSON body, if not nil, and decodes the response to out.
+func (c *Client) do(method string, url string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("Unauthorized, check --user and --password")
+	}
+	if res.StatusCode/100 != 2 {
+		var e apiError
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+			return fmt.Errorf("%s %s: %s", method, url, res.Status)
+		}
+		if len(e.Errors) > 0 {
+			return fmt.Errorf("%s", strings.Join(e.Errors, "\n"))
+		}
+		return fmt.Errorf("%s", e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/spf13/cobra"
+)
+
+// podsAction mirrors the body the API takes for a pod action.
+type podsAction struct {
+	Action string   `json:"action"`
+	Pods   []string `json:"pods"`
+	Images []string `json:"images,omitempty"`
+	Checks []bool   `json:"checks,omitempty"`
+}
+
+var (
+	namespace  string
+	containers []int
+	toTag      string
+	listQuery  = map[string]*string{
+		"labelSelector": new(string),
+		"status":        new(string),
+		"image":         new(string),
+		"host":          new(string),
+		"sort":          new(string),
+	}
+)
+
+func newPodsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pods",
+		Short: "List pods and run actions on them",
+	}
+	cmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "default", "The namespace of the pods")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the pods in the namespace",
+		RunE:  listPods,
+	}
+	list.Flags().StringVarP(listQuery["labelSelector"], "selector", "l", "", "Only list the pods matching the label selector")
+	list.Flags().StringVar(listQuery["status"], "status", "", "Only list the pods in the status, such as Running or Stopped")
+	list.Flags().StringVar(listQuery["image"], "image", "", "Only list the pods running the image of the private repo")
+	list.Flags().StringVar(listQuery["host"], "host", "", "Only list the pods on the host")
+	list.Flags().StringVar(listQuery["sort"], "sort", "", "Sort ByName or ByBirth, the default")
+	cmd.AddCommand(list)
+
+	for _, action := range []string{"start", "stop", "restart"} {
+		c := &cobra.Command{
+			Use:   action + " POD...",
+			Short: strings.Title(action) + " the containers of the pods",
+			RunE:  runPodsAction(action),
+		}
+		c.Flags().IntSliceVar(&containers, "containers", []int{0}, "The indexes of the containers")
+		cmd.AddCommand(c)
+	}
+
+	sync := &cobra.Command{
+		Use:   "sync POD...",
+		Short: "Copy the pod template of the managing replication controller to the pods",
+		RunE:  runPodsAction("sync"),
+	}
+	cmd.AddCommand(sync)
+
+	for _, action := range []string{"upgrade", "downgrade"} {
+		c := &cobra.Command{
+			Use:   action + " POD...",
+			Short: strings.Title(action) + " the images of the pods to a tag of the private repo",
+			RunE:  runPodsAction(action),
+		}
+		c.Flags().IntSliceVar(&containers, "containers", []int{0}, "The indexes of the containers, only 0 and 1 are supported")
+		c.Flags().StringVar(&toTag, "to", "", "The tag to set, or the newest for upgrade and the previous for downgrade")
+		cmd.AddCommand(c)
+	}
+	return cmd
+}
+
+func listPods(cmd *cobra.Command, args []string) error {
+	query := url.Values{}
+	for key, value := range listQuery {
+		if *value != "" {
+			query.Set(key, *value)
+		}
+	}
+	var pods []page.Pod
+	if err := client.do("GET", client.path("/namespaces/%s/pods?%s", namespace, query.Encode()), nil, &pods); err != nil {
+		return err
+	}
+	return printPods(os.Stdout, pods)
+}
+
+func runPodsAction(action string) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("Need the names of the pods to %s", action)
+		}
+		body := podsAction{Action: action, Pods: args}
+		switch action {
+		case "start", "stop", "restart":
+			body.Checks = checksOf(containers)
+		case "upgrade", "downgrade":
+			images, err := imagesFor(action, args[0])
+			if err != nil {
+				return err
+			}
+			body.Images = images
+		}
+		var pods []page.Pod
+		if err := client.do("POST", client.path("/namespaces/%s/pods", namespace), body, &pods); err != nil {
+			return err
+		}
+		return printPods(os.Stdout, pods)
+	}
+}
+
+// checksOf turns container indexes into the checks of a pod action.
+func checksOf(indexes []int) []bool {
+	var checks []bool
+	for _, i := range indexes {
+		for len(checks) <= i {
+			checks = append(checks, false)
+		}
+		checks[i] = true
+	}
+	return checks
+}
+
+// imagesFor picks the new images of the containers from the tags the
+// server offers for the first pod, as the upgrade form on the pages does.
+// The server only offers the tags of the first two containers.
+func imagesFor(action string, podname string) ([]string, error) {
+	var offered []page.SimpleImage
+	if err := client.do("GET", client.path("/namespaces/%s/pods/%s/tags?action=%s", namespace, podname, action), nil, &offered); err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, i := range containers {
+		if i < 0 || i > 1 {
+			return nil, fmt.Errorf("Can not %s container %d of pod %q, only containers 0 and 1 are supported", action, i, podname)
+		}
+		if i >= len(offered) {
+			return nil, fmt.Errorf("Can not %s container %d of pod %q, it has %d", action, i, podname, len(offered))
+		}
+		image := offered[i]
+		if len(image.Tags) == 0 && image.Newest == "" {
+			return nil, fmt.Errorf("No tag to %s image %q", action, image.Name)
+		}
+		tag := toTag
+		switch {
+		case tag == "" && action == "upgrade" && image.Newest != "":
+			tag = image.Newest
+		case tag == "" && action == "upgrade":
+			tag = image.Tags[len(image.Tags)-1]
+		case tag == "":
+			tag = image.Tags[0]
+		case !contains(image.Tags, tag) && tag != image.Newest:
+			return nil, fmt.Errorf("Can not %s image %q to %q, choose from %v", action, image.Name, tag, image.Tags)
+		}
+		for len(images) <= i {
+			images = append(images, "")
+		}
+		images[i] = image.Name + ":" + tag
+	}
+	return images, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func printPods(w io.Writer, pods []page.Pod) error {
+	if output == "json" {
+		return printJSON(w, pods)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tREADY\tSTATUS\tRESTARTS\tAGE\tHOST\tIMAGES")
+	for _, pod := range pods {
+		var images []string
+		for _, image := range pod.Images {
+			images = append(images, image.Image)
+		}
+		fmt.Fprintf(tw, "%s\t%d/%d\t%s\t%d\t%s\t%s\t%s\n", pod.Name, pod.ReadyContainers, pod.TotalContainers,
+			pod.Status, pod.Restarts, pod.Age, pod.HostIP, strings.Join(images, ","))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,197 @@
+// Package diff compares objects field by field through their JSON form.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a field which differs between two objects. Path names the field
+// like "spec.containers[0].image". Before is nil for an added field and
+// After is nil for a removed one.
+type Change struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, Format(c.Before), Format(c.After))
+}
+
+// Format shows a value in the generic JSON form as JSON.
+func Format(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// Decode turns an object into its generic JSON form of maps, slices and
+// values. A nil object stays nil.
+func Decode(obj interface{}) (interface{}, error) {
+	if obj == nil || (reflect.ValueOf(obj).Kind() == reflect.Ptr && reflect.ValueOf(obj).IsNil()) {
+		return nil, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Objects returns the changes from before to after, either of which can be
+// nil for an object being created or deleted.
+func Objects(before interface{}, after interface{}) ([]Change, error) {
+	b, err := Decode(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := Decode(after)
+	if err != nil {
+		return nil, err
+	}
+	return Values(b, a), nil
+}
+
+// Values returns the changes between two values in the generic JSON form.
+func Values(before interface{}, after interface{}) (changes []Change) {
+	walk("", before, after, &changes)
+	return
+}
+
+func walk(path string, before interface{}, after interface{}, changes *[]Change) {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		if a, ok := after.(map[string]interface{}); ok {
+			for _, key := range keys(b, a) {
+				walk(join(path, key), b[key], a[key], changes)
+			}
+			return
+		}
+	case []interface{}:
+		if a, ok := after.([]interface{}); ok {
+			for i := 0; i < len(b) || i < len(a); i++ {
+				var bi, ai interface{}
+				if i < len(b) {
+					bi = b[i]
+				}
+				if i < len(a) {
+					ai = a[i]
+				}
+				walk(fmt.Sprintf("%s[%d]", path, i), bi, ai, changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, Change{Path: path, Before: before, After: after})
+	}
+}
+
+func keys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				result = append(result, k)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func join(path string, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		key = fmt.Sprintf("%q", key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Without drops the changes under any of the paths, such as the ones the
+// API server updates by itself.
+func Without(changes []Change, paths ...string) []Change {
+	var result []Change
+next:
+	for _, c := range changes {
+		for _, p := range paths {
+			if c.Path == p || strings.HasPrefix(c.Path, p+".") || strings.HasPrefix(c.Path, p+"[") {
+				continue next
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// Conflict is a field which mine and theirs changed differently from base.
+type Conflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base,omitempty"`
+	Mine   interface{} `json:"mine,omitempty"`
+	Theirs interface{} `json:"theirs,omitempty"`
+}
+
+// Merge applies the changes from base to mine and from base to theirs
+// together, values in the generic JSON form. Lists are merged item by item
+// only if none of the sides changed their length. A field changed by both
+// sides differently is a conflict, and keeps the value of theirs.
+func Merge(base interface{}, mine interface{}, theirs interface{}) (merged interface{}, conflicts []Conflict) {
+	merged = merge("", base, mine, theirs, &conflicts)
+	return
+}
+
+func merge(path string, base interface{}, mine interface{}, theirs interface{}, conflicts *[]Conflict) interface{} {
+	switch {
+	case reflect.DeepEqual(mine, theirs):
+		return mine
+	case reflect.DeepEqual(base, mine):
+		return theirs
+	case reflect.DeepEqual(base, theirs):
+		return mine
+	}
+
+	m, mineIsMap := mine.(map[string]interface{})
+	t, theirsIsMap := theirs.(map[string]interface{})
+	if mineIsMap && theirsIsMap {
+		b, _ := base.(map[string]interface{})
+		result := make(map[string]interface{})
+		for _, key := range keys(b, m, t) {
+			if v := merge(join(path, key), b[key], m[key], t[key], conflicts); v != nil {
+				result[key] = v
+			}
+		}
+		return result
+	}
+
+	bl, baseIsList := base.([]interface{})
+	ml, mineIsList := mine.([]interface{})
+	tl, theirsIsList := theirs.([]interface{})
+	if baseIsList && mineIsList && theirsIsList && len(bl) == len(ml) && len(bl) == len(tl) {
+		result := make([]interface{}, len(bl))
+		for i := range bl {
+			result[i] = merge(fmt.Sprintf("%s[%d]", path, i), bl[i], ml[i], tl[i], conflicts)
+		}
+		return result
+	}
+
+	*conflicts = append(*conflicts, Conflict{Path: path, Base: base, Mine: mine, Theirs: theirs})
+	return theirs
+}
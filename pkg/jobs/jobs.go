@@ -0,0 +1,357 @@
+// Package jobs runs long actions in the background, one step per target
+// such as a pod, and keeps their progress in JSON files so that the jobs
+// survive restarts.
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var (
+	// Dir keeps one JSON file per job.
+	Dir = "jobs"
+	// Workers is how many jobs run at the same time, and Concurrency is
+	// how many steps of a job run at the same time.
+	Workers     = 2
+	Concurrency = 5
+	// A step failing with a retryable error is tried up to MaxAttempts
+	// times, waiting RetryDelay longer after every attempt.
+	MaxAttempts = 3
+	RetryDelay  = time.Second
+	// Retention is how long the finished jobs are kept.
+	Retention = 7 * 24 * time.Hour
+
+	jobs      = make(map[string]*Job)
+	jobsLock  sync.Mutex
+	jobSeq    int
+	slots     chan struct{}
+	runner    Runner
+	retryable func(error) bool
+)
+
+// The states of a job and of its steps.
+const (
+	Queued    = "Queued"
+	Pending   = "Pending"
+	Running   = "Running"
+	Succeeded = "Succeeded"
+	Failed    = "Failed"
+	Cancelled = "Cancelled"
+)
+
+// Job is an action of a user on the targets in a namespace.
+type Job struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Action    string    `json:"action"`
+	Images    []string  `json:"images,omitempty"`
+	Checks    []bool    `json:"checks,omitempty"`
+	State     string    `json:"state"`
+	Created   time.Time `json:"created"`
+	Started   time.Time `json:"started,omitempty"`
+	Finished  time.Time `json:"finished,omitempty"`
+	Steps     []Step    `json:"steps"`
+}
+
+// Step is the action on one target.
+type Step struct {
+	Target   string    `json:"target"`
+	State    string    `json:"state"`
+	Attempts int       `json:"attempts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated,omitempty"`
+}
+
+// Done tells if the job has finished.
+func (j Job) Done() bool {
+	return j.State == Succeeded || j.State == Failed || j.State == Cancelled
+}
+
+// Count returns how many steps are in state.
+func (j Job) Count(state string) (n int) {
+	for i := range j.Steps {
+		if j.Steps[i].State == state {
+			n++
+		}
+	}
+	return
+}
+
+func (j *Job) copy() Job {
+	c := *j
+	c.Steps = append([]Step(nil), j.Steps...)
+	return c
+}
+
+// Runner performs the action of job on target.
+type Runner func(job Job, target string) error
+
+// Init loads the jobs in Dir, and resumes the unfinished ones with run.
+// Errors for which retry returns true are retried.
+func Init(run Runner, retry func(error) bool) {
+	runner, retryable = run, retry
+	slots = make(chan struct{}, Workers)
+	if err := os.MkdirAll(Dir, 0750); err != nil {
+		glog.Errorf("Can not create jobs dir %q: %v", Dir, err)
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(Dir, "*.json"))
+	if err != nil {
+		glog.Errorf("Can not list jobs in %q: %v", Dir, err)
+		return
+	}
+
+	var resumed []string
+	jobsLock.Lock()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			glog.Errorf("Can not read job %q: %v", file, err)
+			continue
+		}
+		var j Job
+		if err := json.Unmarshal(data, &j); err != nil {
+			glog.Errorf("Can not decode job %q: %v", file, err)
+			continue
+		}
+		if j.Done() && time.Since(j.Finished) > Retention {
+			os.Remove(file)
+			continue
+		}
+		if !j.Done() {
+			// The steps which were running may or may not have finished,
+			// the actions are safe to perform again.
+			for i := range j.Steps {
+				if j.Steps[i].State == Running {
+					j.Steps[i].State = Pending
+				}
+			}
+			j.State = Queued
+			resumed = append(resumed, j.ID)
+		}
+		jobs[j.ID] = &j
+	}
+	loaded := len(jobs)
+	jobsLock.Unlock()
+
+	sort.Strings(resumed)
+	for _, id := range resumed {
+		glog.Infof("Resume job %s", id)
+		go execute(id)
+	}
+	glog.Infof("Loaded %d jobs from %q", loaded, Dir)
+}
+
+// Submit queues job to perform its action on targets, and returns its ID.
+func Submit(job Job, targets []string) (string, error) {
+	if runner == nil {
+		return "", fmt.Errorf("Forget to call jobs.Init()?")
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("Nothing to do")
+	}
+	job.State = Queued
+	job.Created = time.Now()
+	job.Steps = nil
+	for _, target := range targets {
+		job.Steps = append(job.Steps, Step{Target: target, State: Pending})
+	}
+
+	jobsLock.Lock()
+	jobSeq++
+	job.ID = fmt.Sprintf("%s-%d", job.Created.Format("20060102-150405"), jobSeq)
+	jobs[job.ID] = &job
+	err := save(&job)
+	jobsLock.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	go execute(job.ID)
+	return job.ID, nil
+}
+
+// Get returns a copy of the job.
+func Get(id string) (Job, bool) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	j, ok := jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.copy(), true
+}
+
+// List returns the jobs for which visible returns true, newest first.
+func List(visible func(j *Job) bool) (result []Job) {
+	jobsLock.Lock()
+	for _, j := range jobs {
+		if visible == nil || visible(j) {
+			result = append(result, j.copy())
+		}
+	}
+	jobsLock.Unlock()
+	sort.Sort(sort.Reverse(byCreated(result)))
+	return
+}
+
+type byCreated []Job
+
+func (s byCreated) Len() int      { return len(s) }
+func (s byCreated) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCreated) Less(i, j int) bool {
+	if s[i].Created.Equal(s[j].Created) {
+		return s[i].ID < s[j].ID
+	}
+	return s[i].Created.Before(s[j].Created)
+}
+
+// Cancel skips the steps of the job not started yet. The running steps
+// finish on their own.
+func Cancel(id string) error {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	j, ok := jobs[id]
+	if !ok {
+		return fmt.Errorf("Job %q not found", id)
+	}
+	if j.Done() {
+		return fmt.Errorf("Job %s has finished", id)
+	}
+	now := time.Now()
+	for i := range j.Steps {
+		if j.Steps[i].State == Pending {
+			j.Steps[i].State = Cancelled
+			j.Steps[i].Updated = now
+		}
+	}
+	if j.State == Queued {
+		j.State = Cancelled
+		j.Finished = now
+	}
+	return save(j)
+}
+
+// save writes the job to its file. The caller holds jobsLock.
+func save(j *Job) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(Dir, j.ID+".json")
+	if err := ioutil.WriteFile(file+".tmp", data, 0640); err != nil {
+		glog.Errorf("Can not save job %s: %v", j.ID, err)
+		return err
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		glog.Errorf("Can not save job %s: %v", j.ID, err)
+		return err
+	}
+	return nil
+}
+
+// update changes the job under the lock and saves it.
+func update(id string, change func(j *Job)) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	j := jobs[id]
+	change(j)
+	save(j)
+}
+
+func execute(id string) {
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	var job Job
+	update(id, func(j *Job) {
+		if j.State == Queued {
+			j.State = Running
+			j.Started = time.Now()
+		}
+		job = j.copy()
+	})
+	if job.State != Running {
+		return
+	}
+	glog.Infof("Run job %s: %s %d targets in '%s/%s'", id, job.Action, len(job.Steps), job.Cluster, job.Namespace)
+
+	var wg sync.WaitGroup
+	steps := make(chan struct{}, Concurrency)
+	for i := range job.Steps {
+		steps <- struct{}{}
+		started := false
+		update(id, func(j *Job) {
+			if j.Steps[i].State == Pending {
+				j.Steps[i].State = Running
+				j.Steps[i].Updated = time.Now()
+				started = true
+			}
+		})
+		if !started {
+			<-steps
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-steps }()
+			runStep(id, job, i)
+		}(i)
+	}
+	wg.Wait()
+
+	update(id, func(j *Job) {
+		switch {
+		case j.Count(Cancelled) > 0:
+			j.State = Cancelled
+		case j.Count(Failed) > 0:
+			j.State = Failed
+		default:
+			j.State = Succeeded
+		}
+		j.Finished = time.Now()
+		glog.Infof("Job %s %s", id, strings.ToLower(j.State))
+	})
+}
+
+func runStep(id string, job Job, i int) {
+	target := job.Steps[i].Target
+	for attempt := 1; ; attempt++ {
+		update(id, func(j *Job) {
+			j.Steps[i].Attempts = attempt
+		})
+		err := runner(job, target)
+		if err == nil {
+			update(id, func(j *Job) {
+				j.Steps[i].State = Succeeded
+				j.Steps[i].Error = ""
+				j.Steps[i].Updated = time.Now()
+			})
+			return
+		}
+		glog.Warningf("Job %s failed on %q, attempt %d: %v", id, target, attempt, err)
+		if attempt < MaxAttempts && retryable != nil && retryable(err) {
+			time.Sleep(time.Duration(attempt) * RetryDelay)
+			continue
+		}
+		update(id, func(j *Job) {
+			j.Steps[i].State = Failed
+			j.Steps[i].Error = err.Error()
+			j.Steps[i].Updated = time.Now()
+		})
+		return
+	}
+}
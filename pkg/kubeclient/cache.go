@@ -0,0 +1,347 @@
+package kubeclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/controller/framework"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+)
+
+var (
+	// UseCache enables the watch based cache of the clusters connected
+	// by Update. CacheResync is how often the cache is fully relisted.
+	UseCache    = true
+	CacheResync = 10 * time.Minute
+
+	cacheSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kubecon",
+		Subsystem: "cache",
+		Name:      "synced",
+		Help:      "Whether the cache of a resource has been synced, 1 or 0.",
+	}, []string{"cluster", "resource"})
+	cacheObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kubecon",
+		Subsystem: "cache",
+		Name:      "objects",
+		Help:      "Number of objects in the cache of a resource.",
+	}, []string{"cluster", "resource"})
+	cacheLastEvent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kubecon",
+		Subsystem: "cache",
+		Name:      "last_event_timestamp_seconds",
+		Help:      "Unix time of the last watch event applied to the cache of a resource.",
+	}, []string{"cluster", "resource"})
+	cacheFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubecon",
+		Subsystem: "cache",
+		Name:      "fallbacks_total",
+		Help:      "Number of list calls sent to the API server because the cache could not answer.",
+	}, []string{"cluster", "resource"})
+)
+
+func init() {
+	prometheus.MustRegister(cacheSynced)
+	prometheus.MustRegister(cacheObjects)
+	prometheus.MustRegister(cacheLastEvent)
+	prometheus.MustRegister(cacheFallbacks)
+}
+
+// informer keeps the objects of one resource of a cluster in a local store
+// by watching the API server.
+type informer struct {
+	cluster    string
+	resource   string
+	store      cache.Store
+	controller *framework.Controller
+}
+
+func newInformer(cluster string, c *kube_client.Client, resource string, objType runtime.Object) *informer {
+	i := &informer{cluster: cluster, resource: resource}
+	lw := cache.NewListWatchFromClient(c, resource, api.NamespaceAll, fields.Everything())
+	i.store, i.controller = framework.NewInformer(lw, objType, CacheResync, framework.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { i.observe() },
+		UpdateFunc: func(oldObj, newObj interface{}) { i.observe() },
+		DeleteFunc: func(obj interface{}) { i.observe() },
+	})
+	return i
+}
+
+func (i *informer) observe() {
+	cacheLastEvent.WithLabelValues(i.cluster, i.resource).Set(float64(time.Now().Unix()))
+	cacheObjects.WithLabelValues(i.cluster, i.resource).Set(float64(len(i.store.ListKeys())))
+}
+
+func (i *informer) run(stop <-chan struct{}) {
+	go i.controller.Run(stop)
+	for !i.controller.HasSynced() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	cacheSynced.WithLabelValues(i.cluster, i.resource).Set(1)
+	glog.Infof("Cache of %s in cluster %q synced", i.resource, i.cluster)
+}
+
+func (i *informer) forget() {
+	cacheSynced.DeleteLabelValues(i.cluster, i.resource)
+	cacheObjects.DeleteLabelValues(i.cluster, i.resource)
+	cacheLastEvent.DeleteLabelValues(i.cluster, i.resource)
+	cacheFallbacks.DeleteLabelValues(i.cluster, i.resource)
+}
+
+// list returns the cached objects in namespace matching label, or false if
+// the cache is not synced yet and the caller must ask the API server.
+func (i *informer) list(namespace string, label labels.Selector) ([]runtime.Object, bool) {
+	if !i.controller.HasSynced() {
+		i.fallback()
+		return nil, false
+	}
+	var objs []runtime.Object
+	for _, item := range i.store.List() {
+		obj := item.(runtime.Object)
+		meta, err := api.ObjectMetaFor(obj)
+		if err != nil {
+			glog.Errorf("Unexpected object in the cache of %s: %v", i.resource, err)
+			continue
+		}
+		if namespace != api.NamespaceAll && meta.Namespace != namespace {
+			continue
+		}
+		if !label.Matches(labels.Set(meta.Labels)) {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, true
+}
+
+func (i *informer) fallback() {
+	cacheFallbacks.WithLabelValues(i.cluster, i.resource).Inc()
+}
+
+// clusterCache watches the resources kubecon lists on its pages.
+type clusterCache struct {
+	pods      *informer
+	nodes     *informer
+	rcs       *informer
+	services  *informer
+	endpoints *informer
+	events    *informer
+	stop      chan struct{}
+}
+
+func newClusterCache(name string, c *kube_client.Client) *clusterCache {
+	cc := &clusterCache{
+		pods:      newInformer(name, c, "pods", &api.Pod{}),
+		nodes:     newInformer(name, c, "nodes", &api.Node{}),
+		rcs:       newInformer(name, c, "replicationcontrollers", &api.ReplicationController{}),
+		services:  newInformer(name, c, "services", &api.Service{}),
+		endpoints: newInformer(name, c, "endpoints", &api.Endpoints{}),
+		events:    newInformer(name, c, "events", &api.Event{}),
+		stop:      make(chan struct{}),
+	}
+	for _, i := range cc.informers() {
+		go i.run(cc.stop)
+	}
+	return cc
+}
+
+func (cc *clusterCache) informers() []*informer {
+	return []*informer{cc.pods, cc.nodes, cc.rcs, cc.services, cc.endpoints, cc.events}
+}
+
+// Stop ends the watches and drops the metrics of the cache.
+func (cc *clusterCache) Stop() {
+	close(cc.stop)
+	for _, i := range cc.informers() {
+		i.forget()
+	}
+}
+
+// cachedClient serves the list calls from the cache, and everything else,
+// including Get which must return the latest resourceVersion for updates,
+// from the API server.
+type cachedClient struct {
+	Interface
+	cache *clusterCache
+}
+
+func (c *cachedClient) Pods(namespace string) kube_client.PodInterface {
+	return &cachedPods{PodInterface: c.Interface.Pods(namespace), namespace: namespace, informer: c.cache.pods}
+}
+
+func (c *cachedClient) Nodes() kube_client.NodeInterface {
+	return &cachedNodes{NodeInterface: c.Interface.Nodes(), informer: c.cache.nodes}
+}
+
+func (c *cachedClient) ReplicationControllers(namespace string) kube_client.ReplicationControllerInterface {
+	return &cachedReplicationControllers{ReplicationControllerInterface: c.Interface.ReplicationControllers(namespace), namespace: namespace, informer: c.cache.rcs}
+}
+
+func (c *cachedClient) Services(namespace string) kube_client.ServiceInterface {
+	return &cachedServices{ServiceInterface: c.Interface.Services(namespace), namespace: namespace, informer: c.cache.services}
+}
+
+func (c *cachedClient) Endpoints(namespace string) kube_client.EndpointsInterface {
+	return &cachedEndpoints{EndpointsInterface: c.Interface.Endpoints(namespace), namespace: namespace, informer: c.cache.endpoints}
+}
+
+func (c *cachedClient) Events(namespace string) kube_client.EventInterface {
+	return &cachedEvents{EventInterface: c.Interface.Events(namespace), namespace: namespace, informer: c.cache.events}
+}
+
+type cachedPods struct {
+	kube_client.PodInterface
+	namespace string
+	informer  *informer
+}
+
+func (p *cachedPods) List(label labels.Selector, field fields.Selector) (*api.PodList, error) {
+	if !field.Empty() {
+		p.informer.fallback()
+		return p.PodInterface.List(label, field)
+	}
+	objs, ok := p.informer.list(p.namespace, label)
+	if !ok {
+		return p.PodInterface.List(label, field)
+	}
+	list := &api.PodList{}
+	for _, obj := range objs {
+		list.Items = append(list.Items, *obj.(*api.Pod))
+	}
+	return list, nil
+}
+
+type cachedNodes struct {
+	kube_client.NodeInterface
+	informer *informer
+}
+
+func (n *cachedNodes) List(label labels.Selector, field fields.Selector) (*api.NodeList, error) {
+	if !field.Empty() {
+		n.informer.fallback()
+		return n.NodeInterface.List(label, field)
+	}
+	objs, ok := n.informer.list(api.NamespaceAll, label)
+	if !ok {
+		return n.NodeInterface.List(label, field)
+	}
+	list := &api.NodeList{}
+	for _, obj := range objs {
+		list.Items = append(list.Items, *obj.(*api.Node))
+	}
+	return list, nil
+}
+
+type cachedReplicationControllers struct {
+	kube_client.ReplicationControllerInterface
+	namespace string
+	informer  *informer
+}
+
+func (r *cachedReplicationControllers) List(label labels.Selector) (*api.ReplicationControllerList, error) {
+	objs, ok := r.informer.list(r.namespace, label)
+	if !ok {
+		return r.ReplicationControllerInterface.List(label)
+	}
+	list := &api.ReplicationControllerList{}
+	for _, obj := range objs {
+		list.Items = append(list.Items, *obj.(*api.ReplicationController))
+	}
+	return list, nil
+}
+
+type cachedServices struct {
+	kube_client.ServiceInterface
+	namespace string
+	informer  *informer
+}
+
+func (s *cachedServices) List(label labels.Selector) (*api.ServiceList, error) {
+	objs, ok := s.informer.list(s.namespace, label)
+	if !ok {
+		return s.ServiceInterface.List(label)
+	}
+	list := &api.ServiceList{}
+	for _, obj := range objs {
+		list.Items = append(list.Items, *obj.(*api.Service))
+	}
+	return list, nil
+}
+
+type cachedEndpoints struct {
+	kube_client.EndpointsInterface
+	namespace string
+	informer  *informer
+}
+
+func (e *cachedEndpoints) List(label labels.Selector) (*api.EndpointsList, error) {
+	objs, ok := e.informer.list(e.namespace, label)
+	if !ok {
+		return e.EndpointsInterface.List(label)
+	}
+	list := &api.EndpointsList{}
+	for _, obj := range objs {
+		list.Items = append(list.Items, *obj.(*api.Endpoints))
+	}
+	return list, nil
+}
+
+type cachedEvents struct {
+	kube_client.EventInterface
+	namespace string
+	informer  *informer
+}
+
+func (e *cachedEvents) List(label labels.Selector, field fields.Selector) (*api.EventList, error) {
+	if !field.Empty() {
+		e.informer.fallback()
+		return e.EventInterface.List(label, field)
+	}
+	objs, ok := e.informer.list(e.namespace, label)
+	if !ok {
+		return e.EventInterface.List(label, field)
+	}
+	list := &api.EventList{}
+	for _, obj := range objs {
+		list.Items = append(list.Items, *obj.(*api.Event))
+	}
+	return list, nil
+}
+
+// Search finds the events of an object the same way the API server does,
+// by its kind, namespace, name and uid.
+func (e *cachedEvents) Search(objOrRef runtime.Object) (*api.EventList, error) {
+	ref, err := api.GetReference(objOrRef)
+	if err != nil {
+		return nil, err
+	}
+	objs, ok := e.informer.list(ref.Namespace, labels.Everything())
+	if !ok {
+		return e.EventInterface.Search(objOrRef)
+	}
+	list := &api.EventList{}
+	for _, obj := range objs {
+		event := obj.(*api.Event)
+		involved := event.InvolvedObject
+		if involved.Kind != ref.Kind || involved.Name != ref.Name || involved.Namespace != ref.Namespace {
+			continue
+		}
+		if ref.UID != "" && involved.UID != ref.UID {
+			continue
+		}
+		list.Items = append(list.Items, *event)
+	}
+	return list, nil
+}
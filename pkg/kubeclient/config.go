@@ -0,0 +1,147 @@
+package kubeclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+	kube_clientcmd "k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
+)
+
+// Config tells how to connect to the API server. It is either given field
+// by field, or points to a standard kubeconfig file, or asks for the
+// service account credentials of the pod kubecon runs in.
+type Config struct {
+	APIServerURL string
+	Username     string
+	Password     string
+	BearerToken  string `json:",omitempty"`
+	CAFile       string `json:",omitempty"`
+	CertFile     string `json:",omitempty"`
+	KeyFile      string `json:",omitempty"`
+	// Insecure skips the verification of the API server certificate.
+	Insecure bool `json:",omitempty"`
+
+	// KubeConfig is the path of a standard kubeconfig file, Context
+	// selects one of its contexts instead of the current one.
+	KubeConfig string `json:",omitempty"`
+	Context    string `json:",omitempty"`
+
+	InCluster bool `json:",omitempty"`
+}
+
+// clustersConfig is the content of KubeConfigFile naming several clusters.
+type clustersConfig struct {
+	Default  string
+	Clusters map[string]*Config
+}
+
+// loadKubeConfig reads KubeConfigFile, which is either kubecon's own JSON
+// config of one or several clusters, or a standard kubeconfig file whose
+// contexts become the clusters. Without it kubecon uses the service
+// account when running in a pod, or the built-in test cluster.
+func loadKubeConfig() (configs map[string]*Config, defaultName string) {
+	cfg, err := ioutil.ReadFile(KubeConfigFile)
+	if err != nil {
+		glog.Warningf("Can not read %q: %v", KubeConfigFile, err)
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			glog.Infof("Using the in-cluster service account")
+			return map[string]*Config{DefaultClusterName: {InCluster: true}}, DefaultClusterName
+		}
+		return map[string]*Config{DefaultClusterName: {
+			APIServerURL: "https://61.160.36.122",
+			Username:     "test",
+			Password:     "test123",
+			Insecure:     true,
+		}}, DefaultClusterName
+	}
+	if standard, err := kube_clientcmd.Load(cfg); err == nil && len(standard.Contexts) > 0 {
+		configs = make(map[string]*Config)
+		for name := range standard.Contexts {
+			configs[name] = &Config{KubeConfig: KubeConfigFile, Context: name}
+		}
+		defaultName = standard.CurrentContext
+		if KubeContext != "" {
+			defaultName = KubeContext
+		}
+		glog.Infof("Loaded kubeconfig %q", KubeConfigFile)
+		return configs, defaultName
+	}
+	var multi clustersConfig
+	if err := json.Unmarshal(cfg, &multi); err == nil && len(multi.Clusters) > 0 {
+		glog.Infof("Loaded %d clusters from %q", len(multi.Clusters), KubeConfigFile)
+		return multi.Clusters, multi.Default
+	}
+	single := &Config{}
+	if err := json.Unmarshal(cfg, single); err != nil {
+		glog.Warningf("Can not unmarshal content of %q: %v", KubeConfigFile, err)
+	} else {
+		glog.Infof("Loaded %q", KubeConfigFile)
+	}
+	return map[string]*Config{DefaultClusterName: single}, DefaultClusterName
+}
+
+// SaveKubeConfig writes the config of every cluster to KubeConfigFile.
+func SaveKubeConfig() {
+	clustersLock.RLock()
+	multi := clustersConfig{Default: DefaultCluster, Clusters: make(map[string]*Config)}
+	for name, cluster := range clusters {
+		if cluster.config == nil {
+			continue
+		}
+		if cluster.config.KubeConfig == KubeConfigFile {
+			clustersLock.RUnlock()
+			glog.Errorf("Will not overwrite kubeconfig %q", KubeConfigFile)
+			return
+		}
+		multi.Clusters[name] = cluster.config
+	}
+	clustersLock.RUnlock()
+	data, err := json.MarshalIndent(multi, "", "  ")
+	if err != nil {
+		glog.Errorf("Can not marshal kubeconfig: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(KubeConfigFile, data, 0640); err != nil {
+		glog.Errorf("Can not write %q: %v", KubeConfigFile, err)
+		return
+	}
+	glog.Infof("Saved to %q", KubeConfigFile)
+}
+
+// clientConfig turns a Config into the settings of the kubernetes client.
+func clientConfig(cfg *Config) (*kube_client.Config, error) {
+	var kubeConfig *kube_client.Config
+	var err error
+	switch {
+	case cfg.InCluster:
+		kubeConfig, err = kube_client.InClusterConfig()
+	case cfg.KubeConfig != "":
+		rules := &kube_clientcmd.ClientConfigLoadingRules{ExplicitPath: cfg.KubeConfig}
+		overrides := &kube_clientcmd.ConfigOverrides{CurrentContext: cfg.Context}
+		kubeConfig, err = kube_clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	default:
+		kubeConfig = &kube_client.Config{
+			Host:        cfg.APIServerURL,
+			Username:    cfg.Username,
+			Password:    cfg.Password,
+			BearerToken: cfg.BearerToken,
+			Insecure:    cfg.Insecure,
+			TLSClientConfig: kube_client.TLSClientConfig{
+				CAFile:   cfg.CAFile,
+				CertFile: cfg.CertFile,
+				KeyFile:  cfg.KeyFile,
+			},
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kubeConfig.Version == "" {
+		kubeConfig.Version = APIVersion
+	}
+	return kubeConfig, nil
+}
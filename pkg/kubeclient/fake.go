@@ -0,0 +1,47 @@
+package kubeclient
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/unversioned/testclient"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// Fake implements Interface in memory. It serves the objects it was
+// created with, records the actions against them, and returns canned logs.
+type Fake struct {
+	*testclient.Fake
+
+	// Logs are keyed by "namespace/pod/container".
+	Logs map[string]string
+}
+
+// NewFake returns a Fake which serves objects, install it with Set.
+func NewFake(objects ...runtime.Object) *Fake {
+	return &Fake{
+		Fake: testclient.NewSimpleFake(objects...),
+		Logs: make(map[string]string),
+	}
+}
+
+func (f *Fake) PodLogs(namespace string, name string, opts *api.PodLogOptions) (io.ReadCloser, error) {
+	key := fmt.Sprintf("%s/%s/%s", namespace, name, opts.Container)
+	log, ok := f.Logs[key]
+	if !ok {
+		return nil, fmt.Errorf("No log of %q", key)
+	}
+	return ioutil.NopCloser(strings.NewReader(log)), nil
+}
+
+func (f *Fake) Exec(namespace string, name string, opts *api.PodExecOptions, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	return fmt.Errorf("Can not exec in '%s/%s/%s' of a fake cluster", namespace, name, opts.Container)
+}
+
+func (f *Fake) PodProxy(namespace string, name string, port string, prefix string) (http.Handler, error) {
+	return nil, fmt.Errorf("Can not proxy to '%s/%s:%s' of a fake cluster", namespace, name, port)
+}
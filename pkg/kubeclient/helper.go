@@ -1,116 +1,157 @@
 package kubeclient
 
 import (
-	"encoding/json"
+	"sort"
+	"sync"
+
 	"github.com/golang/glog"
-	"io/ioutil"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/fields"
 	"k8s.io/kubernetes/pkg/labels"
 
 	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
-	kube_clientcmd "k8s.io/kubernetes/pkg/client/unversioned/clientcmd"
-	kube_clientcmdapi "k8s.io/kubernetes/pkg/client/unversioned/clientcmd/api"
 )
 
 const (
 	APIVersion = "v1"
+
+	// DefaultClusterName names the only cluster of a single cluster config.
+	DefaultClusterName = "default"
 )
 
 var (
-	kubeClient     *kube_client.Client
-	KubeConfig     *Config
+	clusters       = make(map[string]*cluster)
+	clustersLock   sync.RWMutex
+	DefaultCluster string
 	KubeConfigFile = "kubeconfig.json"
+	KubeContext    = ""
 )
 
-type Config struct {
-	APIServerURL string
-	Username     string
-	Password     string
+// cluster is a named connection to an API server.
+type cluster struct {
+	config *Config
+	client Interface
+	cache  *clusterCache
 }
 
-func loadKubeConfig() {
-	KubeConfig = &Config{
-		APIServerURL: "https://61.160.36.122",
-		Username:     "test",
-		Password:     "test123",
+// stop ends the cache of the cluster, if any.
+func (c *cluster) stop() {
+	if c != nil && c.cache != nil {
+		c.cache.Stop()
 	}
-	cfg, err := ioutil.ReadFile(KubeConfigFile)
-	if err != nil {
-		glog.Warningf("Can not read %q: %v", KubeConfigFile, err)
-		return
+}
+
+func Init() {
+	configs, defaultName := loadKubeConfig()
+	for name, cfg := range configs {
+		if err := Update(name, cfg); err != nil {
+			glog.Errorf("Can not connect to kubernetes cluster %q: %v", name, err)
+		}
 	}
-	if err := json.Unmarshal(cfg, KubeConfig); err != nil {
-		glog.Warningf("Can not unmarshal content of %q: %v", KubeConfigFile, err)
-		return
+	names := Names()
+	if len(names) == 0 {
+		glog.Fatalf("Can not connect to any kubernetes cluster")
 	}
-	glog.Infof("Loaded %q", KubeConfigFile)
+	DefaultCluster = defaultName
+	if _, ok := Lookup(DefaultCluster); !ok {
+		DefaultCluster = names[0]
+	}
+	glog.Infof("Connected to clusters %v, default to %q", names, DefaultCluster)
 }
 
-func SaveKubeConfig() {
-	data, err := json.MarshalIndent(KubeConfig, "", "  ")
+// Update connects to the named cluster with cfg, adding it if it is new.
+// The current connection is kept if that fails. With UseCache the lists
+// are served from a cache watching the cluster.
+func Update(name string, cfg *Config) error {
+	c, err := getKubeClient(cfg)
 	if err != nil {
-		glog.Errorf("Can not marshal kubeconfig: %v", err)
-		return
+		return err
 	}
-	if err := ioutil.WriteFile(KubeConfigFile, data, 0640); err != nil {
-		glog.Errorf("Can not write %q: %v", KubeConfigFile, err)
-		return
+	updated := &cluster{config: cfg, client: c}
+	if UseCache {
+		updated.cache = newClusterCache(name, c.Client)
+		updated.client = &cachedClient{Interface: updated.client, cache: updated.cache}
 	}
-	glog.Infof("Saved to %q", KubeConfigFile)
+	clustersLock.Lock()
+	old := clusters[name]
+	clusters[name] = updated
+	clustersLock.Unlock()
+	old.stop()
+	return nil
 }
 
-func Init() {
-	var err error
-	if KubeConfig == nil {
-		loadKubeConfig()
-	}
-	kubeClient, err = getKubeClient()
-	if err != nil {
-		glog.Fatalf("Can not connect to kubernetes: %v", err)
-	}
+// Set replaces the client of the named cluster, e.g. with a Fake.
+func Set(name string, c Interface) {
+	clustersLock.Lock()
+	old := clusters[name]
+	clusters[name] = &cluster{client: c}
+	clustersLock.Unlock()
+	old.stop()
 }
 
-func Get() *kube_client.Client {
-	if kubeClient == nil {
-		glog.Fatalf("Forget to call kubeclient.Init()?")
+// Names returns the sorted names of the clusters.
+func Names() (names []string) {
+	clustersLock.RLock()
+	for name := range clusters {
+		names = append(names, name)
 	}
-	return kubeClient
+	clustersLock.RUnlock()
+	sort.Strings(names)
+	return
 }
 
-func getConfigOverrides() (*kube_clientcmd.ConfigOverrides, error) {
-	kubeConfigOverride := kube_clientcmd.ConfigOverrides{
-		ClusterInfo: kube_clientcmdapi.Cluster{
-			APIVersion: APIVersion,
-		},
+// Lookup returns the client of the named cluster.
+func Lookup(name string) (Interface, bool) {
+	clustersLock.RLock()
+	defer clustersLock.RUnlock()
+	cluster, ok := clusters[name]
+	if !ok {
+		return nil, false
 	}
+	return cluster.client, true
+}
 
-	kubeConfigOverride.ClusterInfo.Server = KubeConfig.APIServerURL
-	kubeConfigOverride.ClusterInfo.InsecureSkipTLSVerify = true
+// Get returns the client of a cluster known to exist.
+func Get(name string) Interface {
+	c, ok := Lookup(name)
+	if !ok {
+		glog.Fatalf("Forget to call kubeclient.Init() or to check cluster %q?", name)
+	}
+	return c
+}
 
-	return &kubeConfigOverride, nil
+// GetConfig returns a copy of the config of the named cluster, or nil if it
+// has none such as a Fake.
+func GetConfig(name string) *Config {
+	clustersLock.RLock()
+	defer clustersLock.RUnlock()
+	cluster, ok := clusters[name]
+	if !ok || cluster.config == nil {
+		return nil
+	}
+	cfg := *cluster.config
+	return &cfg
 }
 
-func getKubeClient() (*kube_client.Client, error) {
-	configOverrides, err := getConfigOverrides()
+func getKubeClient(cfg *Config) (*client, error) {
+	kubeConfig, err := clientConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
-
-	kubeConfig := &kube_client.Config{
-		Host:     configOverrides.ClusterInfo.Server,
-		Version:  configOverrides.ClusterInfo.APIVersion,
-		Insecure: configOverrides.ClusterInfo.InsecureSkipTLSVerify,
-		Username: KubeConfig.Username,
-		Password: KubeConfig.Password,
+	c, err := kube_client.New(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := kube_client.TransportFor(kubeConfig)
+	if err != nil {
+		return nil, err
 	}
-	kubeClient := kube_client.NewOrDie(kubeConfig)
-	return kubeClient, nil
+	return &client{Client: c, config: kubeConfig, transport: transport}, nil
 }
 
-func GetAllPods() ([]*api.Pod, error) {
-	podList, err := kubeClient.Pods("").List(labels.Everything(), fields.Everything())
+func GetAllPods(name string) ([]*api.Pod, error) {
+	podList, err := Get(name).Pods("").List(labels.Everything(), fields.Everything())
 	if err != nil {
 		return nil, err
 	}
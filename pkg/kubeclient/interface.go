@@ -0,0 +1,134 @@
+package kubeclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	kube_client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/client/unversioned/remotecommand"
+)
+
+// Interface is the part of the kubernetes API used by kubecon. The handlers
+// only talk to the API server through it, so that a Fake can stand in for
+// a live cluster.
+type Interface interface {
+	kube_client.PodsNamespacer
+	kube_client.ReplicationControllersNamespacer
+	kube_client.ServicesNamespacer
+	kube_client.EndpointsNamespacer
+	kube_client.NodesInterface
+	kube_client.EventNamespacer
+	kube_client.NamespacesInterface
+
+	// PodLogs opens the log stream of a container in a pod.
+	PodLogs(namespace string, name string, opts *api.PodLogOptions) (io.ReadCloser, error)
+
+	// Exec runs a command in a container of a pod, connecting the given
+	// streams to it until the command exits.
+	Exec(namespace string, name string, opts *api.PodExecOptions, stdin io.Reader, stdout io.Writer, stderr io.Writer) error
+
+	// PodProxy returns a handler proxying HTTP requests to a port of a pod
+	// through the API server. The request path is the path in the pod, and
+	// redirects into the pod are rewritten to point under prefix.
+	PodProxy(namespace string, name string, port string, prefix string) (http.Handler, error)
+}
+
+// client implements Interface with a connection to the API server.
+type client struct {
+	*kube_client.Client
+	config *kube_client.Config
+	// transport is shared by the proxies, so that they reuse connections.
+	transport http.RoundTripper
+}
+
+func (c *client) PodLogs(namespace string, name string, opts *api.PodLogOptions) (io.ReadCloser, error) {
+	req := c.RESTClient.
+		Get().
+		Namespace(namespace).
+		Name(name).
+		Resource("pods").
+		SubResource("log").
+		Param("container", opts.Container).
+		Param("follow", strconv.FormatBool(opts.Follow)).
+		Param("previous", strconv.FormatBool(opts.Previous)).
+		Param("timestamps", strconv.FormatBool(opts.Timestamps))
+	if opts.TailLines != nil {
+		req.Param("tailLines", strconv.FormatInt(*opts.TailLines, 10))
+	}
+	if opts.LimitBytes != nil {
+		req.Param("limitBytes", strconv.FormatInt(*opts.LimitBytes, 10))
+	}
+	if opts.SinceSeconds != nil {
+		req.Param("sinceSeconds", strconv.FormatInt(*opts.SinceSeconds, 10))
+	}
+	return req.Stream()
+}
+
+func (c *client) Exec(namespace string, name string, opts *api.PodExecOptions, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	req := c.RESTClient.
+		Post().
+		Namespace(namespace).
+		Name(name).
+		Resource("pods").
+		SubResource("exec").
+		Param("container", opts.Container)
+	return remotecommand.New(req, c.config, opts.Command, stdin, stdout, stderr, opts.TTY).Execute()
+}
+
+func (c *client) PodProxy(namespace string, name string, port string, prefix string) (http.Handler, error) {
+	base := c.RESTClient.
+		Get().
+		Prefix("proxy").
+		Namespace(namespace).
+		Resource("pods").
+		Name(name + ":" + port).
+		URL()
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = base.Scheme
+			req.URL.Host = base.Host
+			// Cleaned, the path stays under the proxy path of the pod.
+			p := path.Clean("/" + req.URL.Path)
+			if strings.HasSuffix(req.URL.Path, "/") && p != "/" {
+				p += "/"
+			}
+			req.URL.Path = base.Path + p
+			req.URL.RawPath = ""
+			req.Host = base.Host
+			// The credentials of kubecon must not reach the pod.
+			req.Header.Del("Authorization")
+			req.Header.Del("Cookie")
+		},
+		Transport: &responseRewriter{RoundTripper: c.transport, from: base.Path, to: strings.TrimSuffix(prefix, "/")},
+	}, nil
+}
+
+// responseRewriter rewrites the redirects of the API server proxy so that
+// the browser stays on kubecon. The pages of the pods are served from the
+// origin of kubecon, so they are sandboxed: their scripts must not act as
+// the signed in user, and their cookies must not reach kubecon.
+type responseRewriter struct {
+	http.RoundTripper
+	from string
+	to   string
+}
+
+func (r *responseRewriter) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Header.Set("Content-Security-Policy", "sandbox")
+	res.Header.Set("X-Content-Type-Options", "nosniff")
+	res.Header.Del("Set-Cookie")
+	if location, err := res.Location(); err == nil && strings.HasPrefix(location.Path, r.from) {
+		res.Header.Set("Location", r.to+strings.TrimPrefix(location.RequestURI(), r.from))
+	}
+	return res, nil
+}
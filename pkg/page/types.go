@@ -3,6 +3,7 @@ package page
 import (
 	"time"
 
+	"github.com/aclisp/kubecon/pkg/diff"
 	"github.com/blang/semver"
 
 	"k8s.io/kubernetes/pkg/api"
@@ -97,6 +98,14 @@ type Summary struct {
 	NodeCount  int
 }
 
+type Cluster struct {
+	Name           string
+	NamespaceCount int
+	PodCount       int
+	NodeCount      int
+	Error          string
+}
+
 type ReplicationController struct {
 	Name            string
 	DesiredReplicas int
@@ -131,9 +140,149 @@ type SimplePod struct {
 type SimpleImage struct {
 	Name string
 	Tags []string
+	// Newest is the newest tag to upgrade to, which Tags may leave out when
+	// there are too many.
+	Newest string `json:",omitempty"`
+	// Details are what the registry knows of the tags, by tag.
+	Details map[string]TagDetail `json:",omitempty"`
+}
+
+type TagDetail struct {
+	Digest      string
+	ShortDigest string
+	Size        int64
+	Created     time.Time
+	Age         string
 }
 
 type CombinedVersion struct {
 	Prefix  string
 	Version semver.Version
 }
+
+type Rollout struct {
+	ID        string
+	User      string
+	Cluster   string
+	Namespace string
+	Action    string
+	Images    []string
+	BatchSize int
+	Timeout   time.Duration
+	OnFailure string
+	State     string
+	Message   string
+	Created   time.Time
+	Finished  time.Time
+	Steps     []RolloutStep
+}
+
+type RolloutStep struct {
+	Pod      string
+	Batch    int
+	State    string
+	Previous []string
+	Error    string
+	Updated  time.Time
+}
+
+type SuspendedPod struct {
+	Namespace  string
+	Name       string
+	State      string
+	Containers []SuspendedContainer
+	Problems   []string
+}
+
+type SuspendedContainer struct {
+	Name  string
+	Image string
+	Time  time.Time
+	User  string
+}
+
+// Drift is how a pod differs from the template of its replication
+// controller. Changes go from the template to the pod.
+type Drift struct {
+	Pod                   string
+	ReplicationController string
+	State                 string
+	// Suspended pods are compared with the images they were running.
+	Suspended bool
+	Changes   []diff.Change
+	Error     string
+}
+
+// ImageRepository is a repository of the private registry, with how many of
+// the pods and the replication controller templates run its images.
+type ImageRepository struct {
+	Name      string
+	Pods      int
+	Templates int
+	// Missing repositories are in use but not in the catalog.
+	Missing bool
+}
+
+// ImageTag is a tag of a repository with the pods and the replication
+// controllers running it.
+type ImageTag struct {
+	Tag string
+	// Detail is empty if the tag was not read from the registry.
+	Detail    TagDetail
+	Pods      []ImageUser
+	Templates []ImageUser
+}
+
+// ImageUser is a pod, or a replication controller by its template, running
+// an image.
+type ImageUser struct {
+	Namespace string
+	Name      string
+}
+
+// ImageLayer is the config or a layer of an image.
+type ImageLayer struct {
+	Digest      string
+	ShortDigest string
+	MediaType   string
+	Size        int64
+}
+
+// ImagePlatform is an image in a manifest list.
+type ImagePlatform struct {
+	Platform string
+	Digest   string
+}
+
+// ImageDetail is the manifest of a tag, with the pods and the replication
+// controllers running it.
+type ImageDetail struct {
+	Name      string
+	Tag       string
+	Digest    string
+	MediaType string
+	Created   time.Time
+	Age       string
+	Size      int64
+	// Platforms are the images of a manifest list, Platform the one shown.
+	Platforms []ImagePlatform
+	Platform  string
+	Config    *ImageLayer `json:",omitempty"`
+	Layers    []ImageLayer
+	Pods      []ImageUser
+	Templates []ImageUser
+}
+
+// StaleImage is a distinct image the pods run, with how far behind the
+// newest tag of its repository it is.
+type StaleImage struct {
+	Image string
+	Tag   string
+	// Newest is the newest tag by the version policy of the repository.
+	Newest string
+	// Behind is how many tags are newer, or -1 if it is unknown.
+	Behind      int
+	PrivateRepo bool
+	Latest      bool
+	Pods        []ImageUser
+}
@@ -0,0 +1,243 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var (
+	// File configures the registries and the version policies of their
+	// repositories.
+	File = "registries.json"
+	// Timeout is the timeout of the requests to the registries.
+	Timeout = 10 * time.Second
+	// DigestTTL is how long the digest of a tag is used before asking the
+	// registry again, as a tag may be pushed again.
+	DigestTTL = time.Minute
+
+	registries []*Registry
+)
+
+// concurrency is how many images are read from a registry at the same time.
+const concurrency = 8
+
+// Registry is where the images starting with Prefix come from.
+type Registry struct {
+	// Name tells the registry in the pages and the links.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Prefix is how the images of the registry start, such as
+	// "registry.example.com:5000/". It defaults to the host of URL.
+	Prefix   string `json:"prefix,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+	// Policies order the tags of the repositories, the first matching a
+	// repository applies. Repositories without a policy use semver.
+	Policies []*Policy `json:"policies,omitempty"`
+
+	*Client `json:"-"`
+}
+
+// Config is the content of File.
+type Config struct {
+	Registries []*Registry `json:"registries"`
+}
+
+// Load reads the registries from a JSON file, and checks them.
+func Load(filename string) ([]*Registry, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Registries) == 0 {
+		return nil, fmt.Errorf("No registry in %q", filename)
+	}
+	names := make(map[string]bool)
+	for _, r := range config.Registries {
+		if err := r.setup(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("Registry %q is configured twice", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return config.Registries, nil
+}
+
+// setup checks the registry and creates its client.
+func (r *Registry) setup() error {
+	if r.URL == "" {
+		return fmt.Errorf("Registry %q has no URL", r.Name)
+	}
+	if r.Prefix == "" {
+		rawurl := r.URL
+		if !strings.Contains(rawurl, "://") {
+			rawurl = "https://" + rawurl
+		}
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return fmt.Errorf("Bad URL of registry %q: %v", r.Name, err)
+		}
+		r.Prefix = u.Host
+	}
+	r.Prefix = strings.TrimSuffix(r.Prefix, "/") + "/"
+	if r.Name == "" {
+		r.Name = strings.TrimSuffix(r.Prefix, "/")
+	}
+	for _, p := range r.Policies {
+		if err := p.compile(); err != nil {
+			return fmt.Errorf("Registry %q: %v", r.Name, err)
+		}
+	}
+	r.Client = New(r.URL, r.Username, r.Password, r.Insecure, Timeout)
+	return nil
+}
+
+// Init loads the registries from File. Without the file, fallback is the
+// only registry.
+func Init(fallback Registry) {
+	list, err := Load(File)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			glog.Warningf("Can not load registries from %q: %v", File, err)
+		}
+		if err := fallback.setup(); err != nil {
+			glog.Fatalf("Bad default registry: %v", err)
+		}
+		list = []*Registry{&fallback}
+	}
+	registries = list
+	for _, r := range registries {
+		glog.Infof("Registry %q at %s serves the images under %q", r.Name, r.URL, r.Prefix)
+	}
+}
+
+// All returns the registries, the default one first.
+func All() []*Registry {
+	return registries
+}
+
+// Default returns the registry of the images named without a prefix.
+func Default() *Registry {
+	if len(registries) == 0 {
+		glog.Fatalf("Forget to call registry.Init()?")
+	}
+	return registries[0]
+}
+
+// Get returns the registry by name. The empty name is the default one.
+func Get(name string) (*Registry, bool) {
+	if name == "" {
+		return Default(), true
+	}
+	for _, r := range registries {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Find returns the registry of a full image name, with the name of the
+// image in the registry. The longest prefix wins.
+func Find(image string) (r *Registry, name string, ok bool) {
+	for _, candidate := range registries {
+		if strings.HasPrefix(image, candidate.Prefix) && (r == nil || len(candidate.Prefix) > len(r.Prefix)) {
+			r = candidate
+		}
+	}
+	if r == nil {
+		return nil, image, false
+	}
+	return r, strings.TrimPrefix(image, r.Prefix), true
+}
+
+// Short returns an image of the default registry without its prefix, and
+// the other images as they are. The pages and the forms show images so.
+func Short(image string) string {
+	if r, name, ok := Find(image); ok && r == Default() {
+		return name
+	}
+	return image
+}
+
+// Full undoes Short: the images of the other registries are kept, and the
+// rest go to the default registry.
+func Full(image string) string {
+	if _, _, ok := Find(image); ok {
+		return image
+	}
+	return Default().Prefix + image
+}
+
+// Policy returns the version policy of the repository name.
+func (r *Registry) Policy(name string) *Policy {
+	for _, p := range r.Policies {
+		if p.matches(name) {
+			return p
+		}
+	}
+	return defaultPolicy
+}
+
+// Versions lists the tags of the repository name which its policy
+// understands, oldest first, and the other tags.
+func (r *Registry) Versions(name string) (versions []string, others []string, err error) {
+	tags, err := r.Tags(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := r.Policy(name)
+	var created map[string]time.Time
+	if p.Type == PolicyPushed {
+		created = make(map[string]time.Time)
+		images, _ := r.Images(name, tags)
+		for tag, image := range images {
+			created[tag] = image.Created
+		}
+	}
+	versions, others = p.Sort(tags, created)
+	return versions, others, nil
+}
+
+// Images reads the tags of the repository name, a few at the same time. It
+// returns the images read, and the errors of the others, by tag.
+func (c *Client) Images(name string, tags []string) (map[string]Image, map[string]error) {
+	images := make(map[string]Image)
+	errs := make(map[string]error)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, tag := range tags {
+		wg.Add(1)
+		go func(tag string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			image, err := c.Image(name, tag)
+			lock.Lock()
+			if err != nil {
+				errs[tag] = err
+			} else {
+				images[tag] = image
+			}
+			lock.Unlock()
+		}(tag)
+	}
+	wg.Wait()
+	return images, errs
+}
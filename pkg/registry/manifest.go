@@ -0,0 +1,248 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// accept lists the manifests the client understands, best first.
+var accept = strings.Join([]string{
+	MediaTypeManifestList,
+	MediaTypeOCIIndex,
+	MediaTypeManifestV2,
+	MediaTypeOCIManifest,
+	MediaTypeSignedManifest,
+	MediaTypeManifestV1,
+}, ", ")
+
+// Descriptor points to a blob, or to a manifest in a manifest list.
+type Descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	Platform  *Platform `json:"platform,omitempty"`
+}
+
+// Platform is what the image of a manifest list runs on.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest is an image manifest of any schema, or a manifest list.
+type Manifest struct {
+	MediaType string
+	Digest    string
+	// Config is set for schema 2, and Layers for schema 1 and 2, base layer
+	// first. The layers of schema 1 have no size.
+	Config Descriptor
+	Layers []Descriptor
+	// Manifests are set for manifest lists.
+	Manifests []Descriptor
+	// Created is set for schema 1, from the history of the image.
+	Created time.Time
+}
+
+// IsList tells if the manifest is a manifest list.
+func (m *Manifest) IsList() bool {
+	return m.MediaType == MediaTypeManifestList || m.MediaType == MediaTypeOCIIndex
+}
+
+// Default returns the linux/amd64 manifest of a manifest list, or the first
+// one.
+func (m *Manifest) Default() (Descriptor, bool) {
+	if len(m.Manifests) == 0 {
+		return Descriptor{}, false
+	}
+	for _, d := range m.Manifests {
+		if d.Platform != nil && d.Platform.OS == "linux" && d.Platform.Architecture == "amd64" {
+			return d, true
+		}
+	}
+	return m.Manifests[0], true
+}
+
+// Size is the compressed size of the config and the layers of a schema 2
+// manifest.
+func (m *Manifest) Size() int64 {
+	size := m.Config.Size
+	for _, layer := range m.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// Manifest gets the manifest of the repository name by a tag or a digest.
+func (c *Client) Manifest(name string, reference string) (*Manifest, error) {
+	res, err := c.get(fmt.Sprintf("/v2/%s/manifests/%s", name, reference), accept)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		MediaType     string       `json:"mediaType"`
+		Config        Descriptor   `json:"config"`
+		Layers        []Descriptor `json:"layers"`
+		Manifests     []Descriptor `json:"manifests"`
+		FSLayers      []struct {
+			BlobSum string `json:"blobSum"`
+		} `json:"fsLayers"`
+		History []struct {
+			V1Compatibility string `json:"v1Compatibility"`
+		} `json:"history"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Can not decode manifest %s:%s: %v", name, reference, err)
+	}
+	m := &Manifest{
+		MediaType: raw.MediaType,
+		Digest:    res.Header.Get("Docker-Content-Digest"),
+		Config:    raw.Config,
+		Layers:    raw.Layers,
+		Manifests: raw.Manifests,
+	}
+	if m.MediaType == "" {
+		m.MediaType = strings.TrimSpace(strings.SplitN(res.Header.Get("Content-Type"), ";", 2)[0])
+	}
+	if raw.SchemaVersion == 1 {
+		m.MediaType = MediaTypeSignedManifest
+		if len(raw.History) > 0 {
+			var v1 struct {
+				Created time.Time `json:"created"`
+			}
+			if json.Unmarshal([]byte(raw.History[0].V1Compatibility), &v1) == nil {
+				m.Created = v1.Created
+			}
+		}
+		// The layers of schema 1 are listed from the top one.
+		for i := len(raw.FSLayers) - 1; i >= 0; i-- {
+			m.Layers = append(m.Layers, Descriptor{Digest: raw.FSLayers[i].BlobSum})
+		}
+	}
+	if m.Digest == "" && raw.SchemaVersion == 2 {
+		m.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	}
+	return m, nil
+}
+
+// Image is what the registry knows of a tagged image.
+type Image struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	// Digest is the digest of the manifest the tag points to, which is a
+	// manifest list for images of many platforms.
+	Digest string `json:"digest"`
+	// Size is the compressed size, 0 if unknown as for schema 1.
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// Image gets the digest, size and created time of the image name:tag. For
+// a manifest list it describes the linux/amd64 image, or the first one.
+// Images are kept by digest, so that only the digest of a tag is read again,
+// once DigestTTL is over.
+func (c *Client) Image(name string, tag string) (Image, error) {
+	digest := c.digest(name, tag)
+	if digest != "" {
+		c.imagesLock.Lock()
+		image, ok := c.images[name+"@"+digest]
+		c.imagesLock.Unlock()
+		if ok {
+			image.Tag = tag
+			return image, nil
+		}
+	}
+
+	m, err := c.Manifest(name, tag)
+	if err != nil {
+		return Image{}, err
+	}
+	image := Image{Name: name, Tag: tag, Digest: m.Digest, Created: m.Created}
+	if m.IsList() {
+		chosen, ok := m.Default()
+		if !ok {
+			return image, fmt.Errorf("Manifest list %s:%s is empty", name, tag)
+		}
+		if m, err = c.Manifest(name, chosen.Digest); err != nil {
+			return image, err
+		}
+	}
+	image.Size = m.Size()
+	if m.Config.Digest != "" {
+		if image.Created, err = c.created(name, m.Config.Digest); err != nil {
+			return image, err
+		}
+	}
+
+	if image.Digest != "" {
+		c.imagesLock.Lock()
+		if c.images == nil {
+			c.images = make(map[string]Image)
+		}
+		c.images[name+"@"+image.Digest] = image
+		c.setDigest(name, tag, image.Digest)
+		c.imagesLock.Unlock()
+	}
+	return image, nil
+}
+
+// digest returns the digest of the manifest of name:tag, from a HEAD
+// request unless it is known for less than DigestTTL, or "" if the registry
+// does not tell.
+func (c *Client) digest(name string, tag string) string {
+	now := time.Now()
+	c.imagesLock.Lock()
+	d, ok := c.digests[name+":"+tag]
+	c.imagesLock.Unlock()
+	if ok && now.Before(d.expires) {
+		return d.digest
+	}
+
+	res, err := c.request("HEAD", fmt.Sprintf("/v2/%s/manifests/%s", name, tag), accept)
+	if err != nil {
+		return ""
+	}
+	res.Body.Close()
+	digest := res.Header.Get("Docker-Content-Digest")
+	if digest != "" {
+		c.imagesLock.Lock()
+		c.setDigest(name, tag, digest)
+		c.imagesLock.Unlock()
+	}
+	return digest
+}
+
+// setDigest remembers the digest of name:tag. The caller holds imagesLock.
+func (c *Client) setDigest(name string, tag string, digest string) {
+	if c.digests == nil {
+		c.digests = make(map[string]cachedDigest)
+	}
+	c.digests[name+":"+tag] = cachedDigest{digest: digest, expires: time.Now().Add(DigestTTL)}
+}
+
+// created reads the created time from the config blob of an image.
+func (c *Client) created(name string, digest string) (time.Time, error) {
+	res, err := c.get(fmt.Sprintf("/v2/%s/blobs/%s", name, digest), "")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer res.Body.Close()
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&config); err != nil {
+		return time.Time{}, fmt.Errorf("Can not decode config %s of %s: %v", digest, name, err)
+	}
+	return config.Created, nil
+}
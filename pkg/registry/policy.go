@@ -0,0 +1,213 @@
+package registry
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/page"
+)
+
+// The types of version policies.
+const (
+	// PolicySemver takes tags such as `1.2.3`, `v1.2.3` and `ANY-1.2.3`.
+	PolicySemver = "semver"
+	// PolicyRegex takes tags matching Pattern, compared by its named groups.
+	PolicyRegex = "regex"
+	// PolicyDate takes tags which are times in Format.
+	PolicyDate = "date"
+	// PolicyPushed takes every tag, ordered by the created time of its image.
+	PolicyPushed = "pushed"
+)
+
+// defaultPolicy applies to the repositories no policy matches.
+var defaultPolicy = &Policy{Type: PolicySemver}
+
+// Policy tells how the tags of the repositories matching Repository are
+// ordered, to pick the tags to upgrade and downgrade to.
+type Policy struct {
+	// Repository is a pattern of path.Match, such as "rds/*". Empty
+	// matches every repository.
+	Repository string `json:"repository,omitempty"`
+	Type       string `json:"type"`
+	// Pattern is the regexp of a regex policy. Its named groups are compared
+	// in Order, or in the order they appear, as numbers if both are digits.
+	Pattern string   `json:"pattern,omitempty"`
+	Order   []string `json:"order,omitempty"`
+	// Format is the layout of a date policy, as in time.Parse.
+	Format string `json:"format,omitempty"`
+
+	regexp *regexp.Regexp
+	// groups are the indexes of the submatches to compare.
+	groups []int
+}
+
+// compile checks the policy and prepares its regexp.
+func (p *Policy) compile() error {
+	if _, err := path.Match(p.Repository, ""); err != nil {
+		return fmt.Errorf("Bad repository pattern %q: %v", p.Repository, err)
+	}
+	switch p.Type {
+	case PolicySemver, PolicyPushed:
+	case PolicyDate:
+		if p.Format == "" {
+			return fmt.Errorf("Date policy of %q needs a format", p.Repository)
+		}
+	case PolicyRegex:
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("Bad pattern of %q: %v", p.Repository, err)
+		}
+		p.regexp, p.groups = re, nil
+		names := p.Order
+		if len(names) == 0 {
+			names = re.SubexpNames()
+		}
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			i := subexpIndex(re, name)
+			if i < 0 {
+				return fmt.Errorf("Pattern of %q has no group %q", p.Repository, name)
+			}
+			p.groups = append(p.groups, i)
+		}
+		if len(p.groups) == 0 {
+			return fmt.Errorf("Pattern of %q has no named group", p.Repository)
+		}
+	default:
+		return fmt.Errorf("Unknown policy %q of %q", p.Type, p.Repository)
+	}
+	return nil
+}
+
+func subexpIndex(re *regexp.Regexp, name string) int {
+	for i, n := range re.SubexpNames() {
+		if i > 0 && n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *Policy) matches(name string) bool {
+	if p.Repository == "" {
+		return true
+	}
+	ok, _ := path.Match(p.Repository, name)
+	return ok
+}
+
+func (p *Policy) String() string {
+	switch p.Type {
+	case PolicyRegex:
+		return p.Type + " " + p.Pattern
+	case PolicyDate:
+		return p.Type + " " + p.Format
+	}
+	return p.Type
+}
+
+// version is a tag with what a policy compares.
+type version struct {
+	tag    string
+	fields []string
+	time   time.Time
+}
+
+// Sort returns the tags the policy understands, oldest first, and the tags
+// it does not. Created has the times the images of the tags were created,
+// which only a pushed policy needs.
+func (p *Policy) Sort(tags []string, created map[string]time.Time) (sorted []string, others []string) {
+	if p.Type == PolicySemver {
+		var versions []page.CombinedVersion
+		for _, tag := range tags {
+			if v, err := page.ParseImageTag(tag); err == nil {
+				versions = append(versions, v)
+			} else {
+				others = append(others, tag)
+			}
+		}
+		page.SortCombinedVersions(versions)
+		return page.CombinedVersionsToStrings(versions), others
+	}
+
+	var versions []version
+	for _, tag := range tags {
+		v := version{tag: tag}
+		ok := false
+		switch p.Type {
+		case PolicyRegex:
+			if m := p.regexp.FindStringSubmatch(tag); m != nil {
+				for _, i := range p.groups {
+					v.fields = append(v.fields, m[i])
+				}
+				ok = true
+			}
+		case PolicyDate:
+			var err error
+			v.time, err = time.Parse(p.Format, tag)
+			ok = err == nil
+		case PolicyPushed:
+			v.time, ok = created[tag]
+			ok = ok && !v.time.IsZero()
+		}
+		if ok {
+			versions = append(versions, v)
+		} else {
+			others = append(others, tag)
+		}
+	}
+	sort.Sort(byVersion(versions))
+	for _, v := range versions {
+		sorted = append(sorted, v.tag)
+	}
+	return sorted, others
+}
+
+type byVersion []version
+
+func (s byVersion) Len() int      { return len(s) }
+func (s byVersion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byVersion) Less(i, j int) bool {
+	for k := 0; k < len(s[i].fields) && k < len(s[j].fields); k++ {
+		if c := compareField(s[i].fields[k], s[j].fields[k]); c != 0 {
+			return c < 0
+		}
+	}
+	if !s[i].time.Equal(s[j].time) {
+		return s[i].time.Before(s[j].time)
+	}
+	return s[i].tag < s[j].tag
+}
+
+// compareField compares two groups of a regex policy, as numbers if both
+// are digits.
+func compareField(a string, b string) int {
+	if isDigits(a) && isDigits(b) {
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,384 @@
+// Package registry is a client of the Docker Registry HTTP API V2. It
+// authenticates with basic auth or bearer tokens as the registry asks,
+// follows the pagination of the catalog and the tags, and reads manifests
+// of schema 1, schema 2 and manifest lists. It also keeps the configured
+// registries, with the version policies ordering the tags of their
+// repositories.
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The media types of the manifests.
+const (
+	MediaTypeManifestV1     = "application/vnd.docker.distribution.manifest.v1+json"
+	MediaTypeSignedManifest = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	MediaTypeManifestV2     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList   = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+)
+
+// pageSize is how many items are asked for in a page of the catalog or
+// the tags.
+const pageSize = 100
+
+// Client talks to one registry.
+type Client struct {
+	// URL is the registry, such as "https://registry.example.com".
+	URL      string
+	Username string
+	Password string
+	// HTTP sends the requests, with a timeout.
+	HTTP *http.Client
+
+	// authorizations are the Authorization headers which worked, by the
+	// token scope, or "*" for basic auth.
+	authLock       sync.Mutex
+	authorizations map[string]string
+
+	// images are the images already read, by name@digest, and digests are
+	// the digests of the tags, by name:tag, trusted for DigestTTL.
+	imagesLock sync.Mutex
+	images     map[string]Image
+	digests    map[string]cachedDigest
+}
+
+type cachedDigest struct {
+	digest  string
+	expires time.Time
+}
+
+// New returns a client of the registry at rawurl. A URL without a scheme
+// is https. Insecure skips the verification of the certificate.
+func New(rawurl string, username string, password string, insecure bool, timeout time.Duration) *Client {
+	if !strings.Contains(rawurl, "://") {
+		rawurl = "https://" + rawurl
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Client{
+		URL:      strings.TrimSuffix(rawurl, "/"),
+		Username: username,
+		Password: password,
+		HTTP:     &http.Client{Transport: transport, Timeout: timeout},
+	}
+}
+
+// Error is an error response of the registry.
+type Error struct {
+	StatusCode int
+	Errors     []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Code+": "+err.Message)
+	}
+	if len(msgs) == 0 {
+		return fmt.Sprintf("registry returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("registry returned %d: %s", e.StatusCode, strings.Join(msgs, "; "))
+}
+
+// IsNotFound tells if err is a 404 of the registry.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Catalog lists the repositories in the registry.
+func (c *Client) Catalog() ([]string, error) {
+	var repos []string
+	err := c.paginate(fmt.Sprintf("/v2/_catalog?n=%d", pageSize), func(body io.Reader) error {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		repos = append(repos, page.Repositories...)
+		return nil
+	})
+	return repos, err
+}
+
+// Tags lists the tags of the repository name.
+func (c *Client) Tags(name string) ([]string, error) {
+	var tags []string
+	err := c.paginate(fmt.Sprintf("/v2/%s/tags/list?n=%d", name, pageSize), func(body io.Reader) error {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		tags = append(tags, page.Tags...)
+		return nil
+	})
+	return tags, err
+}
+
+// paginate gets path and the pages in its `Link` headers, and reads each
+// of them with read.
+func (c *Client) paginate(path string, read func(body io.Reader) error) error {
+	for path != "" {
+		res, err := c.get(path, "")
+		if err != nil {
+			return err
+		}
+		err = read(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("Can not decode %s: %v", path, err)
+		}
+		path = nextPage(res.Header.Get("Link"))
+	}
+	return nil
+}
+
+// nextPage returns the target of a `Link: <url>; rel="next"` header.
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.Contains(part, `rel="next"`) && !strings.Contains(part, "rel=next") {
+			continue
+		}
+		start, end := strings.Index(part, "<"), strings.Index(part, ">")
+		if start < 0 || end < start {
+			continue
+		}
+		target := part[start+1 : end]
+		if u, err := url.Parse(target); err == nil && u.IsAbs() {
+			// Stay on the registry, the path is all we need.
+			target = u.RequestURI()
+		}
+		return target
+	}
+	return ""
+}
+
+// get sends a GET of path to the registry, authenticating if it asks for.
+// The caller closes the body of the response. Accept is a comma separated
+// list of media types, or "".
+func (c *Client) get(path string, accept string) (*http.Response, error) {
+	return c.request("GET", path, accept)
+}
+
+func (c *Client) request(method string, path string, accept string) (*http.Response, error) {
+	res, err := c.do(method, path, accept, "")
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		authorization, err := c.authorize(challenge)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = c.do(method, path, accept, authorization); err != nil {
+			return nil, err
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		e := &Error{StatusCode: res.StatusCode}
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+		json.Unmarshal(data, e)
+		return nil, e
+	}
+	return res, nil
+}
+
+func (c *Client) do(method string, path string, accept string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization == "" {
+		authorization = c.cachedAuthorization(path)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.HTTP.Do(req)
+}
+
+// authorize answers the challenge of a 401 response, and returns the value
+// of the Authorization header to try again with. It is kept for the later
+// requests.
+func (c *Client) authorize(challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	scope, authorization := "*", ""
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.Username == "" {
+			return "", fmt.Errorf("Registry %s needs a username", c.URL)
+		}
+		authorization = basicAuthorization(c.Username, c.Password)
+	case "bearer":
+		token, err := c.token(params["realm"], params["service"], params["scope"])
+		if err != nil {
+			return "", err
+		}
+		scope, authorization = params["scope"], "Bearer "+token
+	default:
+		return "", fmt.Errorf("Registry %s asks for unknown authentication %q", c.URL, challenge)
+	}
+
+	c.authLock.Lock()
+	if c.authorizations == nil {
+		c.authorizations = make(map[string]string)
+	}
+	c.authorizations[scope] = authorization
+	c.authLock.Unlock()
+	return authorization, nil
+}
+
+// token gets a bearer token for scope from the token server at realm.
+func (c *Client) token(realm string, service string, scope string) (string, error) {
+	if realm == "" {
+		return "", fmt.Errorf("Registry %s asks for a token without a realm", c.URL)
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if service != "" {
+		q.Set("service", service)
+	}
+	if scope != "" {
+		q.Set("scope", scope)
+	}
+	if c.Username != "" {
+		q.Set("account", c.Username)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token server %s returned %d %s", realm, res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("Can not decode the token from %s: %v", realm, err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("Token server %s returned no token", realm)
+	}
+	return token, nil
+}
+
+// cachedAuthorization returns the Authorization header known to work for
+// path, so that most requests do not need a 401 round trip.
+func (c *Client) cachedAuthorization(path string) string {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+	if authorization, ok := c.authorizations[scopeOf(path)]; ok {
+		return authorization
+	}
+	return c.authorizations["*"]
+}
+
+// scopeOf returns the token scope a request of path usually needs.
+func scopeOf(path string) string {
+	path = strings.SplitN(path, "?", 2)[0]
+	if strings.HasPrefix(path, "/v2/_catalog") {
+		return "registry:catalog:*"
+	}
+	for _, sep := range []string{"/tags/", "/manifests/", "/blobs/"} {
+		if i := strings.Index(path, sep); i > 0 {
+			return "repository:" + strings.TrimPrefix(path[:i], "/v2/") + ":pull"
+		}
+	}
+	return ""
+}
+
+func basicAuthorization(username string, password string) string {
+	req := http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(username, password)
+	return req.Header.Get("Authorization")
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry"`.
+func parseChallenge(header string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+	header = strings.TrimSpace(header)
+	i := strings.IndexAny(header, " \t")
+	if i < 0 {
+		return header, params
+	}
+	scheme, rest := header[:i], strings.TrimSpace(header[i+1:])
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rest) {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = strings.Replace(rest[1:end], `\"`, `"`, -1), rest[end+1:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = strings.TrimSpace(rest[:end]), rest[end:]
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+		rest = strings.TrimSpace(rest)
+	}
+	return scheme, params
+}
@@ -0,0 +1,333 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manifest is what the fake registry serves for a manifest or a blob.
+type manifest struct {
+	mediaType string
+	body      string
+	// noDigest leaves out the Docker-Content-Digest header.
+	noDigest bool
+}
+
+func (m manifest) digest() string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(m.body)))
+}
+
+// fakeRegistry serves the manifests and the blobs by path, and counts the
+// requests by method.
+type fakeRegistry struct {
+	sync.Mutex
+	files    map[string]manifest
+	requests map[string]int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	f.requests[req.Method]++
+	m, ok := f.files[req.URL.Path]
+	f.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`)
+		return
+	}
+	if m.mediaType != "" {
+		w.Header().Set("Content-Type", m.mediaType)
+	}
+	if !m.noDigest {
+		w.Header().Set("Docker-Content-Digest", m.digest())
+	}
+	if req.Method != "HEAD" {
+		fmt.Fprint(w, m.body)
+	}
+}
+
+func (f *fakeRegistry) count(method string) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests[method]
+}
+
+func newFakeRegistry(files map[string]manifest) (*fakeRegistry, *httptest.Server, *Client) {
+	f := &fakeRegistry{files: files, requests: make(map[string]int)}
+	server := httptest.NewServer(f)
+	return f, server, New(server.URL, "", "", false, time.Second)
+}
+
+func TestBearerTokenAndReauthentication(t *testing.T) {
+	var lock sync.Mutex
+	issued, valid := 0, ""
+	var scopes []string
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != "alice" || password != "secret" || req.URL.Query().Get("service") != "registry" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		lock.Lock()
+		issued++
+		valid = fmt.Sprintf("token-%d", issued)
+		scopes = append(scopes, req.URL.Query().Get("scope"))
+		token := valid
+		lock.Unlock()
+		fmt.Fprintf(w, `{"token":%q}`, token)
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		ok := valid != "" && req.Header.Get("Authorization") == "Bearer "+valid
+		lock.Unlock()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:web:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"name":"web","tags":["1.0.0"]}`)
+	})
+
+	c := New(server.URL, "alice", "secret", false, time.Second)
+	for i := 0; i < 2; i++ {
+		tags, err := c.Tags("web")
+		if err != nil || !reflect.DeepEqual(tags, []string{"1.0.0"}) {
+			t.Fatalf("got %v, %v", tags, err)
+		}
+	}
+	if issued != 1 {
+		t.Errorf("got %d tokens, want the first one reused", issued)
+	}
+
+	// The token expires, a new one is asked for.
+	lock.Lock()
+	valid = "expired"
+	lock.Unlock()
+	if _, err := c.Tags("web"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"repository:web:pull", "repository:web:pull"}; !reflect.DeepEqual(scopes, want) {
+		t.Errorf("got scopes %v, want %v", scopes, want)
+	}
+
+	c = New(server.URL, "alice", "wrong", false, time.Second)
+	if _, err := c.Tags("web"); err == nil {
+		t.Error("bad password: got no error")
+	}
+}
+
+func TestBasicAuthentication(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if username, password, ok := req.BasicAuth(); !ok || username != "alice" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"repositories":["web"]}`)
+	}))
+	defer server.Close()
+
+	repos, err := New(server.URL, "alice", "secret", false, time.Second).Catalog()
+	if err != nil || !reflect.DeepEqual(repos, []string{"web"}) {
+		t.Errorf("got %v, %v", repos, err)
+	}
+	if _, err := New(server.URL, "", "", false, time.Second).Catalog(); err == nil {
+		t.Error("no username: got no error")
+	}
+}
+
+func TestTagsPagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/web/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch req.URL.Query().Get("last") {
+		case "":
+			// A relative next page.
+			w.Header().Set("Link", `</v2/web/tags/list?n=100&last=b>; rel="next"`)
+			fmt.Fprint(w, `{"tags":["a","b"]}`)
+		case "b":
+			// An absolute one, among other links.
+			w.Header().Set("Link", fmt.Sprintf(`<%s/v2/web/tags/list?n=100>; rel="first", <%s/v2/web/tags/list?n=100&last=d>; rel="next"`, server.URL, server.URL))
+			fmt.Fprint(w, `{"tags":["c","d"]}`)
+		case "d":
+			fmt.Fprint(w, `{"tags":["e"]}`)
+		}
+	}))
+	defer server.Close()
+
+	tags, err := New(server.URL, "", "", false, time.Second).Tags("web")
+	if want := []string{"a", "b", "c", "d", "e"}; err != nil || !reflect.DeepEqual(tags, want) {
+		t.Errorf("got %v, %v, want %v", tags, err, want)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"", ""},
+		{`</v2/_catalog?n=100&last=b>; rel="next"`, "/v2/_catalog?n=100&last=b"},
+		{`<https://registry.example.com/v2/web/tags/list?last=b>; rel=next`, "/v2/web/tags/list?last=b"},
+		{`</v2/_catalog?n=100>; rel="first", </v2/_catalog?last=x>; rel="next"`, "/v2/_catalog?last=x"},
+		{`</v2/_catalog?n=100>; rel="prev"`, ""},
+	}
+	for _, test := range tests {
+		if got := nextPage(test.link); got != test.want {
+			t.Errorf("nextPage(%q) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:a/b:pull,push"`)
+	want := map[string]string{"realm": "https://auth.example.com/token", "service": "registry", "scope": "repository:a/b:pull,push"}
+	if scheme != "Bearer" || !reflect.DeepEqual(params, want) {
+		t.Errorf("got %s %v, want Bearer %v", scheme, params, want)
+	}
+}
+
+var (
+	created   = time.Date(2016, 3, 4, 5, 6, 7, 0, time.UTC)
+	configV2  = manifest{body: fmt.Sprintf(`{"created":%q}`, created.Format(time.RFC3339))}
+	schema2   = manifest{mediaType: MediaTypeManifestV2, body: fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"size":100,"digest":%q},"layers":[{"size":1000,"digest":"sha256:l1"},{"size":2000,"digest":"sha256:l2"}]}`, MediaTypeManifestV2, configV2.digest())}
+	armV2     = manifest{mediaType: MediaTypeManifestV2, body: fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"size":1,"digest":%q},"layers":[]}`, MediaTypeManifestV2, configV2.digest())}
+	schema1   = manifest{mediaType: MediaTypeSignedManifest, body: fmt.Sprintf(`{"schemaVersion":1,"fsLayers":[{"blobSum":"sha256:top"},{"blobSum":"sha256:base"}],"history":[{"v1Compatibility":"{\"created\":\"%s\"}"}]}`, created.Format(time.RFC3339))}
+	indexList = manifest{mediaType: MediaTypeManifestList, body: fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[{"digest":%q,"platform":{"architecture":"arm","os":"linux"}},{"digest":%q,"platform":{"architecture":"amd64","os":"linux"}}]}`, MediaTypeManifestList, armV2.digest(), schema2.digest())}
+)
+
+func testFiles() map[string]manifest {
+	return map[string]manifest{
+		"/v2/web/manifests/2.0.0":               schema2,
+		"/v2/web/manifests/" + schema2.digest(): schema2,
+		"/v2/web/manifests/" + armV2.digest():   armV2,
+		"/v2/web/manifests/1.0.0":               schema1,
+		"/v2/web/manifests/multi":               indexList,
+		"/v2/web/blobs/" + configV2.digest():    configV2,
+		"/v2/web/manifests/nodigest":            {mediaType: MediaTypeManifestV2, body: schema2.body, noDigest: true},
+	}
+}
+
+func TestManifestSchemas(t *testing.T) {
+	_, server, c := newFakeRegistry(testFiles())
+	defer server.Close()
+
+	m, err := c.Manifest("web", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaType != MediaTypeSignedManifest || !m.Created.Equal(created) {
+		t.Errorf("schema 1: got %s created %v", m.MediaType, m.Created)
+	}
+	if want := []Descriptor{{Digest: "sha256:base"}, {Digest: "sha256:top"}}; !reflect.DeepEqual(m.Layers, want) {
+		t.Errorf("schema 1: got layers %+v, want the base first", m.Layers)
+	}
+
+	m, err = c.Manifest("web", "2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaType != MediaTypeManifestV2 || m.Digest != schema2.digest() || m.Size() != 3100 || m.Config.Digest != configV2.digest() {
+		t.Errorf("schema 2: got %+v with size %d", m, m.Size())
+	}
+
+	m, err = c.Manifest("web", "multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, ok := m.Default()
+	if !m.IsList() || !ok || d.Digest != schema2.digest() {
+		t.Errorf("manifest list: got %+v, default %+v", m, d)
+	}
+
+	// Without the header the digest of schema 2 is that of the body.
+	m, err = c.Manifest("web", "nodigest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Digest != schema2.digest() {
+		t.Errorf("got digest %q, want %q", m.Digest, schema2.digest())
+	}
+
+	if _, err := c.Manifest("web", "missing"); !IsNotFound(err) {
+		t.Errorf("got %v, want a 404", err)
+	}
+}
+
+func TestImage(t *testing.T) {
+	_, server, c := newFakeRegistry(testFiles())
+	defer server.Close()
+
+	tests := []struct {
+		tag  string
+		want Image
+	}{
+		{"2.0.0", Image{Name: "web", Tag: "2.0.0", Digest: schema2.digest(), Size: 3100, Created: created}},
+		{"1.0.0", Image{Name: "web", Tag: "1.0.0", Digest: schema1.digest(), Created: created}},
+		// The digest is that of the list, the rest of the amd64 image.
+		{"multi", Image{Name: "web", Tag: "multi", Digest: indexList.digest(), Size: 3100, Created: created}},
+		{"nodigest", Image{Name: "web", Tag: "nodigest", Digest: schema2.digest(), Size: 3100, Created: created}},
+	}
+	for _, test := range tests {
+		image, err := c.Image("web", test.tag)
+		if err != nil {
+			t.Errorf("%s: %v", test.tag, err)
+			continue
+		}
+		if !image.Created.Equal(test.want.Created) {
+			t.Errorf("%s: created %v, want %v", test.tag, image.Created, test.want.Created)
+		}
+		image.Created = test.want.Created
+		if image != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.tag, image, test.want)
+		}
+	}
+}
+
+func TestImagesCacheDigests(t *testing.T) {
+	defer func(ttl time.Duration) { DigestTTL = ttl }(DigestTTL)
+	DigestTTL = time.Hour
+	f, server, c := newFakeRegistry(testFiles())
+	defer server.Close()
+
+	tags := []string{"2.0.0", "multi", "missing"}
+	for i := 0; i < 3; i++ {
+		images, errs := c.Images("web", tags)
+		if len(images) != 2 || len(errs) != 1 || errs["missing"] == nil {
+			t.Fatalf("got %v, %v", images, errs)
+		}
+	}
+	// The missing tag is asked for every time, the others once.
+	if heads, gets := f.count("HEAD"), f.count("GET"); heads != 3+2 || gets != 6+2 {
+		t.Errorf("got %d HEAD and %d GET requests, want 5 and 8", heads, gets)
+	}
+
+	// Once the digests expire they are asked for again, not the images.
+	c.imagesLock.Lock()
+	for key, d := range c.digests {
+		d.expires = time.Now()
+		c.digests[key] = d
+	}
+	c.imagesLock.Unlock()
+	c.Images("web", []string{"2.0.0"})
+	if heads, gets := f.count("HEAD"), f.count("GET"); heads != 5+1 || gets != 8 {
+		t.Errorf("got %d HEAD and %d GET requests, want 6 and 8", heads, gets)
+	}
+	c.Images("web", []string{"2.0.0"})
+	if heads, gets := f.count("HEAD"), f.count("GET"); heads != 6 || gets != 8 {
+		t.Errorf("got %d HEAD and %d GET requests, want the digest cached again", heads, gets)
+	}
+}
@@ -0,0 +1,287 @@
+// Package schedule performs the actions on the pods matching a label
+// selector at the times of cron expressions, and keeps the schedules with
+// the history of their runs in a JSON file.
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var (
+	// File keeps all the schedules.
+	File = "schedules.json"
+	// MaxRuns is how many runs are kept in the history of a schedule.
+	MaxRuns = 50
+
+	schedules = make(map[string]*Schedule)
+	lock      sync.Mutex
+	seq       int
+	runner    Runner
+)
+
+// Schedule performs Action on the pods matching Selector in a namespace, as
+// User, whenever Cron matches.
+type Schedule struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Cluster   string    `json:"cluster"`
+	Namespace string    `json:"namespace"`
+	Selector  string    `json:"selector"`
+	Action    string    `json:"action"`
+	Checks    []bool    `json:"checks,omitempty"`
+	Cron      string    `json:"cron"`
+	Enabled   bool      `json:"enabled"`
+	Created   time.Time `json:"created"`
+	Next      time.Time `json:"next,omitempty"`
+	Runs      []Run     `json:"runs,omitempty"`
+}
+
+// Run is one time a schedule was due, newest first in Schedule.Runs.
+type Run struct {
+	Time time.Time `json:"time"`
+	// Manual runs are started by hand rather than by the cron expression.
+	Manual bool     `json:"manual,omitempty"`
+	Pods   []string `json:"pods,omitempty"`
+	// Job is the background job doing the action, if it could be started.
+	Job   string `json:"job,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (s *Schedule) copy() Schedule {
+	c := *s
+	c.Checks = append([]bool(nil), s.Checks...)
+	c.Runs = append([]Run(nil), s.Runs...)
+	return c
+}
+
+func (s *Schedule) record(run Run) {
+	s.Runs = append([]Run{run}, s.Runs...)
+	if len(s.Runs) > MaxRuns {
+		s.Runs = s.Runs[:MaxRuns]
+	}
+}
+
+// Runner starts the action of a schedule, and returns the pods it works on
+// with the ID of the job doing it.
+type Runner func(s Schedule) (pods []string, job string, err error)
+
+// Init loads the schedules from File and starts checking them every minute
+// with run. The runs missed while kubecon was down are recorded as failed.
+func Init(run Runner) {
+	runner = run
+	data, err := ioutil.ReadFile(File)
+	if err != nil && !os.IsNotExist(err) {
+		glog.Errorf("Can not read schedules %q: %v", File, err)
+	}
+	var list []*Schedule
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &list); err != nil {
+			glog.Errorf("Can not decode schedules %q: %v", File, err)
+		}
+	}
+
+	now := time.Now()
+	lock.Lock()
+	for _, s := range list {
+		if s.Enabled && !s.Next.IsZero() && s.Next.Before(now) {
+			s.record(Run{Time: s.Next, Error: "Missed, kubecon was not running"})
+			s.Next = next(s.Cron, now)
+		}
+		schedules[s.ID] = s
+	}
+	save()
+	lock.Unlock()
+	glog.Infof("Loaded %d schedules from %q", len(list), File)
+
+	go loop()
+}
+
+func loop() {
+	for {
+		now := time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		tick(time.Now())
+	}
+}
+
+// tick runs the schedules due at now.
+func tick(now time.Time) {
+	var due []Schedule
+	lock.Lock()
+	for _, s := range schedules {
+		if s.Enabled && !s.Next.IsZero() && !s.Next.After(now) {
+			due = append(due, s.copy())
+			s.Next = next(s.Cron, now)
+		}
+	}
+	if len(due) > 0 {
+		save()
+	}
+	lock.Unlock()
+
+	for _, s := range due {
+		go execute(s, s.Next, false)
+	}
+}
+
+// execute starts the action of the schedule due at, and records the run.
+func execute(s Schedule, at time.Time, manual bool) {
+	glog.Infof("Run schedule %s: %s %q in '%s/%s'", s.ID, s.Action, s.Selector, s.Cluster, s.Namespace)
+	run := Run{Time: at, Manual: manual}
+	pods, job, err := runner(s)
+	run.Pods, run.Job = pods, job
+	if err != nil {
+		glog.Warningf("Schedule %s failed: %v", s.ID, err)
+		run.Error = err.Error()
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if current, ok := schedules[s.ID]; ok {
+		current.record(run)
+		save()
+	}
+}
+
+func next(expr string, now time.Time) time.Time {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return time.Time{}
+	}
+	return cron.Next(now)
+}
+
+// Add validates the cron expression of the schedule and adds it, enabled.
+// Expressions which never match, such as `0 0 30 2 *`, are rejected.
+func Add(s Schedule) (Schedule, error) {
+	if runner == nil {
+		return s, fmt.Errorf("Forget to call schedule.Init()?")
+	}
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return s, err
+	}
+	s.Created = time.Now()
+	s.Next = cron.Next(s.Created)
+	if s.Next.IsZero() {
+		return s, fmt.Errorf("Cron expression %q never matches", s.Cron)
+	}
+	s.Cron = cron.String()
+	s.Enabled = true
+	s.Runs = nil
+
+	lock.Lock()
+	defer lock.Unlock()
+	seq++
+	s.ID = fmt.Sprintf("%s-%d", s.Created.Format("20060102-150405"), seq)
+	schedules[s.ID] = &s
+	return s.copy(), save()
+}
+
+// Get returns a copy of the schedule.
+func Get(id string) (Schedule, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	s, ok := schedules[id]
+	if !ok {
+		return Schedule{}, false
+	}
+	return s.copy(), true
+}
+
+// List returns the schedules for which visible returns true, oldest first.
+func List(visible func(s *Schedule) bool) (result []Schedule) {
+	lock.Lock()
+	for _, s := range schedules {
+		if visible == nil || visible(s) {
+			result = append(result, s.copy())
+		}
+	}
+	lock.Unlock()
+	sort.Sort(byCreated(result))
+	return
+}
+
+type byCreated []Schedule
+
+func (s byCreated) Len() int      { return len(s) }
+func (s byCreated) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCreated) Less(i, j int) bool {
+	if s[i].Created.Equal(s[j].Created) {
+		return s[i].ID < s[j].ID
+	}
+	return s[i].Created.Before(s[j].Created)
+}
+
+// Enable turns the schedule on or off.
+func Enable(id string, enabled bool) error {
+	lock.Lock()
+	defer lock.Unlock()
+	s, ok := schedules[id]
+	if !ok {
+		return fmt.Errorf("Schedule %q not found", id)
+	}
+	s.Enabled = enabled
+	s.Next = time.Time{}
+	if enabled {
+		s.Next = next(s.Cron, time.Now())
+	}
+	return save()
+}
+
+// Delete removes the schedule with its history.
+func Delete(id string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := schedules[id]; !ok {
+		return fmt.Errorf("Schedule %q not found", id)
+	}
+	delete(schedules, id)
+	return save()
+}
+
+// RunNow runs the schedule once in the background, leaving its next time
+// alone.
+func RunNow(id string) error {
+	s, ok := Get(id)
+	if !ok {
+		return fmt.Errorf("Schedule %q not found", id)
+	}
+	go execute(s, time.Now(), true)
+	return nil
+}
+
+type byID []*Schedule
+
+func (s byID) Len() int           { return len(s) }
+func (s byID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+// save writes all the schedules to File. The caller holds lock.
+func save() error {
+	list := make([]*Schedule, 0, len(schedules))
+	for _, s := range schedules {
+		list = append(list, s)
+	}
+	sort.Sort(byID(list))
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(File+".tmp", data, 0640); err != nil {
+		glog.Errorf("Can not save schedules: %v", err)
+		return err
+	}
+	if err := os.Rename(File+".tmp", File); err != nil {
+		glog.Errorf("Can not save schedules: %v", err)
+		return err
+	}
+	return nil
+}
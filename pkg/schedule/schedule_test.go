@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	now := time.Date(2016, 1, 29, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2016, 1, 29, 12, 31, 0, 0, time.UTC)},
+		{"0 22 * * 1-5", time.Date(2016, 1, 29, 22, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2016, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"0 0 31 4,6,9,11 *", time.Time{}},
+	}
+	for _, test := range tests {
+		cron, err := ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := cron.Next(now); !got.Equal(test.want) {
+			t.Errorf("%s: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestAddRejectsCronsNeverMatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	File = filepath.Join(dir, "schedules.json")
+	runner = func(s Schedule) ([]string, string, error) { return nil, "", nil }
+
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4 *"} {
+		if _, err := Add(Schedule{Action: "stop", Cron: expr}); err == nil {
+			t.Errorf("%s: got no error", expr)
+		}
+	}
+	if got := List(nil); len(got) != 0 {
+		t.Errorf("got schedules %+v, want none", got)
+	}
+
+	s, err := Add(Schedule{Action: "stop", Cron: "0 22 * * 1-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Enabled || s.Next.IsZero() {
+		t.Errorf("got %+v, want it enabled with a next time", s)
+	}
+}
@@ -0,0 +1,266 @@
+// Package suspend stops the containers of a pod without deleting it, by
+// swapping their images for PauseImage, and remembers the images in an
+// annotation of the pod to start them again.
+package suspend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	// PauseImage does nothing but sleep.
+	PauseImage = "sigmas/pause:0.8.0"
+	// Annotation keeps the suspended containers of a pod as a JSON list.
+	Annotation = "kubecon/suspended"
+	// legacyPrefix is followed by the container index in the annotations
+	// of the pods stopped by older versions, whose values are the images.
+	legacyPrefix = "paused"
+)
+
+// The states of a pod.
+const (
+	Running   = "Running"
+	Suspended = "Suspended"
+	// Partly is a pod with some of its containers suspended.
+	Partly = "PartlySuspended"
+	// Broken is a pod which can not be resumed as it is, see Check.
+	Broken = "Broken"
+)
+
+// Container is a suspended container.
+type Container struct {
+	Index int       `json:"index"`
+	Name  string    `json:"name"`
+	Image string    `json:"image"`
+	Time  time.Time `json:"time"`
+	User  string    `json:"user"`
+}
+
+// Get returns the suspended containers recorded in the pod, including the
+// ones recorded by older versions.
+func Get(pod *api.Pod) ([]Container, error) {
+	var containers []Container
+	if value, ok := pod.Annotations[Annotation]; ok {
+		if err := json.Unmarshal([]byte(value), &containers); err != nil {
+			return nil, fmt.Errorf("Bad annotation %q of pod %q: %v", Annotation, pod.Name, err)
+		}
+	}
+	for key, image := range pod.Annotations {
+		if !strings.HasPrefix(key, legacyPrefix) {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimPrefix(key, legacyPrefix))
+		if err != nil || find(containers, i) >= 0 {
+			continue
+		}
+		c := Container{Index: i, Image: image}
+		if i < len(pod.Spec.Containers) {
+			c.Name = pod.Spec.Containers[i].Name
+		}
+		containers = append(containers, c)
+	}
+	sort.Sort(byIndex(containers))
+	return containers, nil
+}
+
+type byIndex []Container
+
+func (s byIndex) Len() int           { return len(s) }
+func (s byIndex) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byIndex) Less(i, j int) bool { return s[i].Index < s[j].Index }
+
+func find(containers []Container, index int) int {
+	for i := range containers {
+		if containers[i].Index == index {
+			return i
+		}
+	}
+	return -1
+}
+
+// set records containers in the pod, replacing the legacy annotations.
+func set(pod *api.Pod, containers []Container) error {
+	for key := range pod.Annotations {
+		if !strings.HasPrefix(key, legacyPrefix) {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(key, legacyPrefix)); err == nil {
+			delete(pod.Annotations, key)
+		}
+	}
+	if len(containers) == 0 {
+		delete(pod.Annotations, Annotation)
+		return nil
+	}
+	data, err := json.Marshal(containers)
+	if err != nil {
+		return err
+	}
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[Annotation] = string(data)
+	return nil
+}
+
+// validate checks that the selected containers exist.
+func validate(pod *api.Pod, checks []bool) error {
+	for i, check := range checks {
+		if check && i >= len(pod.Spec.Containers) {
+			return fmt.Errorf("Pod %q has %d containers, can not select container %d", pod.Name, len(pod.Spec.Containers), i)
+		}
+	}
+	return nil
+}
+
+// Suspend swaps the images of the selected containers for PauseImage, and
+// records them as suspended by user. The suspended ones are left alone.
+func Suspend(pod *api.Pod, checks []bool, user string, now time.Time) error {
+	if err := validate(pod, checks); err != nil {
+		return err
+	}
+	containers, err := Get(pod)
+	if err != nil {
+		return err
+	}
+	for i, check := range checks {
+		if !check || pod.Spec.Containers[i].Image == PauseImage {
+			continue
+		}
+		container := &pod.Spec.Containers[i]
+		if j := find(containers, i); j >= 0 {
+			// A stale record, the container has been started some other way.
+			containers = append(containers[:j], containers[j+1:]...)
+		}
+		containers = append(containers, Container{Index: i, Name: container.Name, Image: container.Image, Time: now, User: user})
+		container.Image = PauseImage
+	}
+	sort.Sort(byIndex(containers))
+	return set(pod, containers)
+}
+
+// Resume sets the recorded images back to the selected containers. It fails
+// without changing the pod if a suspended container has no image recorded.
+func Resume(pod *api.Pod, checks []bool) error {
+	if err := validate(pod, checks); err != nil {
+		return err
+	}
+	containers, err := Get(pod)
+	if err != nil {
+		return err
+	}
+	images := make(map[int]string)
+	for i, check := range checks {
+		if !check || pod.Spec.Containers[i].Image != PauseImage {
+			continue
+		}
+		j := find(containers, i)
+		if j < 0 || containers[j].Image == "" {
+			return fmt.Errorf("No image recorded for suspended container %q of pod %q, recover it first", pod.Spec.Containers[i].Name, pod.Name)
+		}
+		images[i] = containers[j].Image
+	}
+	for i, image := range images {
+		pod.Spec.Containers[i].Image = image
+		containers = append(containers[:find(containers, i)], containers[find(containers, i)+1:]...)
+	}
+	return set(pod, containers)
+}
+
+// Check tells the state of the pod, with the problems which make it Broken:
+// containers on PauseImage without a recorded image, records of containers
+// not on PauseImage any more, and records of unknown containers.
+func Check(pod *api.Pod) (state string, problems []string) {
+	containers, err := Get(pod)
+	if err != nil {
+		return Broken, []string{err.Error()}
+	}
+	suspended := 0
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		j := find(containers, i)
+		switch {
+		case container.Image == PauseImage && (j < 0 || containers[j].Image == ""):
+			problems = append(problems, fmt.Sprintf("Container %q is suspended without an image recorded", container.Name))
+		case container.Image == PauseImage:
+			suspended++
+		case j >= 0:
+			problems = append(problems, fmt.Sprintf("Container %q runs %s but is recorded as suspended", container.Name, container.Image))
+		}
+	}
+	for _, c := range containers {
+		if c.Index >= len(pod.Spec.Containers) {
+			problems = append(problems, fmt.Sprintf("Container %d is recorded as suspended but does not exist", c.Index))
+		}
+	}
+	switch {
+	case len(problems) > 0:
+		return Broken, problems
+	case suspended == 0:
+		return Running, nil
+	case suspended == len(pod.Spec.Containers):
+		return Suspended, nil
+	}
+	return Partly, nil
+}
+
+// Prune drops the records of the containers not on PauseImage any more,
+// such as the ones upgraded or synced while suspended.
+func Prune(pod *api.Pod) error {
+	containers, err := Get(pod)
+	if err != nil {
+		return err
+	}
+	var kept []Container
+	for _, c := range containers {
+		if c.Index < len(pod.Spec.Containers) && pod.Spec.Containers[c.Index].Image == PauseImage {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(containers) && pod.Annotations[Annotation] != "" {
+		return nil
+	}
+	return set(pod, kept)
+}
+
+// Recover fixes a Broken pod: the stale records are dropped, and the
+// containers suspended without an image recorded are given the image
+// returned by fallback, usually the one of the replication controller. It
+// returns what it has done.
+func Recover(pod *api.Pod, fallback func(container string) (image string, ok bool)) ([]string, error) {
+	containers, err := Get(pod)
+	if err != nil {
+		// Start over from a clean annotation.
+		delete(pod.Annotations, Annotation)
+		containers, _ = Get(pod)
+	}
+	var done []string
+	var kept []Container
+	for _, c := range containers {
+		if c.Index < len(pod.Spec.Containers) && pod.Spec.Containers[c.Index].Image == PauseImage && c.Image != "" {
+			kept = append(kept, c)
+		} else {
+			done = append(done, fmt.Sprintf("Dropped the record of container %d", c.Index))
+		}
+	}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if container.Image != PauseImage || find(kept, i) >= 0 {
+			continue
+		}
+		image, ok := fallback(container.Name)
+		if !ok || image == "" || image == PauseImage {
+			return done, fmt.Errorf("No image known for suspended container %q of pod %q", container.Name, pod.Name)
+		}
+		container.Image = image
+		done = append(done, fmt.Sprintf("Started container %q with %s", container.Name, image))
+	}
+	return done, set(pod, kept)
+}
@@ -0,0 +1,328 @@
+package suspend
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+var now = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newPod returns a pod running images, with annotations.
+func newPod(annotations map[string]string, images ...string) *api.Pod {
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "web-1", Annotations: annotations}}
+	for i, image := range images {
+		pod.Spec.Containers = append(pod.Spec.Containers, api.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+	}
+	return pod
+}
+
+func images(pod *api.Pod) (images []string) {
+	for _, c := range pod.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	return
+}
+
+func TestSuspend(t *testing.T) {
+	tests := []struct {
+		name   string
+		pod    *api.Pod
+		checks []bool
+		images []string
+		want   []Container
+		err    bool
+	}{
+		{
+			name:   "nil annotations",
+			pod:    newPod(nil, "web:1", "log:1"),
+			checks: []bool{true},
+			images: []string{PauseImage, "log:1"},
+			want:   []Container{{Index: 0, Name: "c0", Image: "web:1", Time: now, User: "alice"}},
+		},
+		{
+			name:   "already suspended",
+			pod:    newPod(map[string]string{Annotation: `[{"index":0,"name":"c0","image":"web:1"}]`}, PauseImage, "log:1"),
+			checks: []bool{true, true},
+			images: []string{PauseImage, PauseImage},
+			want: []Container{
+				{Index: 0, Name: "c0", Image: "web:1"},
+				{Index: 1, Name: "c1", Image: "log:1", Time: now, User: "alice"},
+			},
+		},
+		{
+			name:   "stale record",
+			pod:    newPod(map[string]string{Annotation: `[{"index":0,"name":"c0","image":"web:1"}]`}, "web:2"),
+			checks: []bool{true},
+			images: []string{PauseImage},
+			want:   []Container{{Index: 0, Name: "c0", Image: "web:2", Time: now, User: "alice"}},
+		},
+		{
+			name:   "legacy annotation",
+			pod:    newPod(map[string]string{"paused0": "web:1"}, PauseImage, "log:1"),
+			checks: []bool{false, true},
+			images: []string{PauseImage, PauseImage},
+			want: []Container{
+				{Index: 0, Name: "c0", Image: "web:1"},
+				{Index: 1, Name: "c1", Image: "log:1", Time: now, User: "alice"},
+			},
+		},
+		{
+			name:   "out of range",
+			pod:    newPod(nil, "web:1"),
+			checks: []bool{false, true},
+			images: []string{"web:1"},
+			err:    true,
+		},
+	}
+	for _, test := range tests {
+		err := Suspend(test.pod, test.checks, "alice", now)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+		if got := images(test.pod); !reflect.DeepEqual(got, test.images) {
+			t.Errorf("%s: got images %v, want %v", test.name, got, test.images)
+		}
+		if test.err {
+			continue
+		}
+		if _, ok := test.pod.Annotations["paused0"]; ok {
+			t.Errorf("%s: legacy annotation kept", test.name)
+		}
+		got, err := Get(test.pod)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, %v, want %+v", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	suspended := `[{"index":0,"name":"c0","image":"web:1"},{"index":1,"name":"c1","image":"log:1"}]`
+	tests := []struct {
+		name       string
+		pod        *api.Pod
+		checks     []bool
+		images     []string
+		annotation string
+		err        bool
+	}{
+		{
+			name:       "all",
+			pod:        newPod(map[string]string{Annotation: suspended}, PauseImage, PauseImage),
+			checks:     []bool{true, true},
+			images:     []string{"web:1", "log:1"},
+			annotation: "",
+		},
+		{
+			name:       "some",
+			pod:        newPod(map[string]string{Annotation: suspended}, PauseImage, PauseImage),
+			checks:     []bool{false, true},
+			images:     []string{PauseImage, "log:1"},
+			annotation: `[{"index":0,"name":"c0","image":"web:1","time":"0001-01-01T00:00:00Z","user":""}]`,
+		},
+		{
+			name:       "legacy annotation",
+			pod:        newPod(map[string]string{"paused0": "web:1", "paused1": "log:1"}, PauseImage, PauseImage),
+			checks:     []bool{true},
+			images:     []string{"web:1", PauseImage},
+			annotation: `[{"index":1,"name":"c1","image":"log:1","time":"0001-01-01T00:00:00Z","user":""}]`,
+		},
+		{
+			name:   "missing image",
+			pod:    newPod(map[string]string{Annotation: `[{"index":1,"name":"c1","image":"log:1"}]`}, PauseImage, PauseImage),
+			checks: []bool{true, true},
+			images: []string{PauseImage, PauseImage},
+			err:    true,
+		},
+		{
+			name:   "nil annotations",
+			pod:    newPod(nil, PauseImage),
+			checks: []bool{true},
+			images: []string{PauseImage},
+			err:    true,
+		},
+		{
+			name:   "out of range",
+			pod:    newPod(map[string]string{Annotation: suspended}, PauseImage),
+			checks: []bool{true, true},
+			images: []string{PauseImage},
+			err:    true,
+		},
+	}
+	for _, test := range tests {
+		before := test.pod.Annotations[Annotation]
+		err := Resume(test.pod, test.checks)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+		if got := images(test.pod); !reflect.DeepEqual(got, test.images) {
+			t.Errorf("%s: got images %v, want %v", test.name, got, test.images)
+		}
+		if test.err {
+			if got := test.pod.Annotations[Annotation]; got != before {
+				t.Errorf("%s: failed but changed the annotation to %s", test.name, got)
+			}
+			continue
+		}
+		if got := test.pod.Annotations[Annotation]; got != test.annotation {
+			t.Errorf("%s: got annotation %s, want %s", test.name, got, test.annotation)
+		}
+		if _, ok := test.pod.Annotations["paused0"]; ok {
+			t.Errorf("%s: legacy annotation kept", test.name)
+		}
+	}
+}
+
+func TestGetMergesLegacyAnnotations(t *testing.T) {
+	pod := newPod(map[string]string{
+		Annotation: `[{"index":1,"name":"c1","image":"log:1"}]`,
+		"paused0":  "web:1",
+		// Recorded in both, the annotation wins.
+		"paused1": "log:0",
+		// Not a legacy annotation.
+		"pausedBy": "bob",
+	}, PauseImage, PauseImage)
+	got, err := Get(pod)
+	want := []Container{{Index: 0, Name: "c0", Image: "web:1"}, {Index: 1, Name: "c1", Image: "log:1"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, %v, want %+v", got, err, want)
+	}
+
+	pod.Annotations[Annotation] = "{"
+	if _, err := Get(pod); err == nil {
+		t.Error("bad annotation: got no error")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      *api.Pod
+		state    string
+		problems int
+	}{
+		{"running", newPod(nil, "web:1", "log:1"), Running, 0},
+		{"suspended", newPod(map[string]string{"paused0": "web:1", "paused1": "log:1"}, PauseImage, PauseImage), Suspended, 0},
+		{"partly", newPod(map[string]string{Annotation: `[{"index":1,"image":"log:1"}]`}, "web:1", PauseImage), Partly, 0},
+		{"no image recorded", newPod(nil, PauseImage), Broken, 1},
+		{"empty image recorded", newPod(map[string]string{Annotation: `[{"index":0,"image":""}]`}, PauseImage), Broken, 1},
+		{"stale record", newPod(map[string]string{Annotation: `[{"index":0,"image":"web:1"}]`}, "web:2"), Broken, 1},
+		{"unknown container", newPod(map[string]string{Annotation: `[{"index":3,"image":"web:1"}]`}, "web:1"), Broken, 1},
+		{"bad annotation", newPod(map[string]string{Annotation: "["}, "web:1"), Broken, 1},
+	}
+	for _, test := range tests {
+		state, problems := Check(test.pod)
+		if state != test.state || len(problems) != test.problems {
+			t.Errorf("%s: got %s with %q, want %s with %d problems", test.name, state, problems, test.state, test.problems)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	fallback := func(container string) (string, bool) {
+		if container == "c0" {
+			return "web:3", true
+		}
+		return "", false
+	}
+	tests := []struct {
+		name     string
+		pod      *api.Pod
+		fallback func(string) (string, bool)
+		images   []string
+		state    string
+		err      bool
+	}{
+		{
+			name:     "fallback image",
+			pod:      newPod(nil, PauseImage, "log:1"),
+			fallback: fallback,
+			images:   []string{"web:3", "log:1"},
+			state:    Running,
+		},
+		{
+			name:     "recorded image kept",
+			pod:      newPod(map[string]string{Annotation: `[{"index":0,"image":"web:1"},{"index":1,"image":"log:1"},{"index":5,"image":"x:1"}]`}, PauseImage, "log:2"),
+			fallback: fallback,
+			images:   []string{PauseImage, "log:2"},
+			state:    Partly,
+		},
+		{
+			name:     "bad annotation",
+			pod:      newPod(map[string]string{Annotation: "[", "paused1": "log:1"}, PauseImage, PauseImage),
+			fallback: fallback,
+			images:   []string{"web:3", PauseImage},
+			state:    Partly,
+		},
+		{
+			name:     "no fallback image",
+			pod:      newPod(nil, "web:1", PauseImage),
+			fallback: fallback,
+			images:   []string{"web:1", PauseImage},
+			err:      true,
+		},
+		{
+			name:     "fallback to the pause image",
+			pod:      newPod(nil, PauseImage),
+			fallback: func(string) (string, bool) { return PauseImage, true },
+			images:   []string{PauseImage},
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		done, err := Recover(test.pod, test.fallback)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+		if got := images(test.pod); !reflect.DeepEqual(got, test.images) {
+			t.Errorf("%s: got images %v, want %v", test.name, got, test.images)
+		}
+		if test.err {
+			continue
+		}
+		if len(done) == 0 {
+			t.Errorf("%s: nothing reported done", test.name)
+		}
+		if state, problems := Check(test.pod); state != test.state {
+			t.Errorf("%s: got %s with %q, want %s", test.name, state, problems, test.state)
+		}
+	}
+}
+
+func TestPruneAfterUpgrade(t *testing.T) {
+	pod := newPod(map[string]string{"paused0": "web:1", "paused1": "log:1"}, PauseImage, PauseImage)
+	// The first container is upgraded while suspended.
+	pod.Spec.Containers[0].Image = "web:2"
+	if state, _ := Check(pod); state != Broken {
+		t.Fatalf("got %s before pruning, want %s", state, Broken)
+	}
+	if err := Prune(pod); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Get(pod)
+	want := []Container{{Index: 1, Name: "c1", Image: "log:1"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, %v, want %+v", got, err, want)
+	}
+	for key := range pod.Annotations {
+		if strings.HasPrefix(key, legacyPrefix) {
+			t.Errorf("legacy annotation %s kept", key)
+		}
+	}
+	if state, _ := Check(pod); state != Partly {
+		t.Errorf("got %s after pruning, want %s", state, Partly)
+	}
+
+	// Nothing left suspended.
+	pod.Spec.Containers[1].Image = "log:2"
+	if err := Prune(pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pod.Annotations[Annotation]; ok {
+		t.Errorf("got annotation %s, want none", pod.Annotations[Annotation])
+	}
+}
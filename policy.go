@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// authorize checks the signed in user can perform verb in namespace of
+// the requested cluster, or in the cluster scope if namespace is empty.
+// It renders the 403 error page and returns false if not. Every handler
+// calls it before writing through kubeclient.
+func authorize(c *gin.Context, namespace string, verb auth.Verb) bool {
+	user := c.MustGet(gin.AuthUserKey).(string)
+	cluster := c.Param("cluster")
+	if auth.Allowed(user, cluster, namespace, verb) {
+		return true
+	}
+	scope := cluster + "/" + namespace
+	if namespace == "" {
+		scope = cluster
+	}
+	glog.Warningf("Denied %s of user %q on %q", verb, user, scope)
+	renderError(c, http.StatusForbidden, fmt.Sprintf("User %q has no %s permission on %q", user, verb, scope))
+	return false
+}
+
+// checkTarget makes sure the posted object is the one addressed by the
+// URL, so that a crafted body can not write to another object. An empty
+// name accepts any name, for objects being created.
+func checkTarget(c *gin.Context, meta *api.ObjectMeta, namespace string, name string) bool {
+	if (meta.Namespace == "" || meta.Namespace == namespace) && (name == "" || meta.Name == name) {
+		return true
+	}
+	renderError(c, http.StatusForbidden, fmt.Sprintf("Object '%s/%s' does not match the target '%s/%s'", meta.Namespace, meta.Name, namespace, name))
+	return false
+}
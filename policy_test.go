@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+func TestMutatingHandlersRejectNonOwners(t *testing.T) {
+	pod := api.Pod{ObjectMeta: api.ObjectMeta{Name: "web-1", Namespace: "rds"}}
+	endpoints := api.Endpoints{ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: "rds"}}
+	node := api.Node{ObjectMeta: api.ObjectMeta{Name: "node-1"}}
+	service := api.Service{ObjectMeta: api.ObjectMeta{Name: "new", Namespace: "rds"}}
+	podsAction := url.Values{"action": {"stop"}, "pods": {`["web-1"]`}, "images": {`[]`}, "checks": {`[true]`}}
+
+	tests := []struct {
+		name string
+		user string
+		path string
+		form url.Values
+	}{
+		{"updatePod", "other", "/clusters/test/namespaces/rds/pods/web-1/update", url.Values{"json": {toJSON(t, pod)}}},
+		{"deleteService", "other", "/clusters/test/namespaces/rds/services/svc/delete", url.Values{}},
+		{"deleteService needs manage", "operator", "/clusters/test/namespaces/rds/services/svc/delete", url.Values{}},
+		{"updateEndpoints", "other", "/clusters/test/namespaces/rds/endpoints/svc/update", url.Values{"json": {toJSON(t, endpoints)}}},
+		{"deleteReplicationController", "other", "/clusters/test/namespaces/rds/replicationcontrollers/web/delete", url.Values{}},
+		{"deleteReplicationController needs manage", "operator", "/clusters/test/namespaces/rds/replicationcontrollers/web/delete", url.Values{}},
+		{"updateNode", "operator", "/clusters/test/nodes/node-1/update", url.Values{"json": {toJSON(t, node)}}},
+		{"deleteNode", "operator", "/clusters/test/nodes/node-1/delete", url.Values{}},
+		{"createService", "other", "/clusters/test/namespaces/rds/services", url.Values{"json": {toJSON(t, service)}}},
+		{"createService needs manage", "operator", "/clusters/test/namespaces/rds/services", url.Values{"json": {toJSON(t, service)}}},
+		{"performPodsAction", "other", "/clusters/test/namespaces/rds/pods", podsAction},
+		{"apiPerformPodsAction", "other", "/api/v1/clusters/test/namespaces/rds/pods", podsAction},
+	}
+	for _, test := range tests {
+		r, fake := setUp(t, testObjects()...)
+		w := request(r, test.user, "POST", test.path, test.form)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s by %s: got %d, want %d", test.name, test.user, w.Code, http.StatusForbidden)
+		}
+		if actions := writes(fake); len(actions) > 0 {
+			t.Errorf("%s by %s: wrote %v", test.name, test.user, actions)
+		}
+	}
+}
+
+func TestCheckTargetRejectsMismatchedBodies(t *testing.T) {
+	inOther := api.ObjectMeta{Name: "web-1", Namespace: "other"}
+	renamed := api.ObjectMeta{Name: "web-2", Namespace: "rds"}
+
+	tests := []struct {
+		name string
+		path string
+		obj  interface{}
+	}{
+		{"pod in another namespace", "/clusters/test/namespaces/rds/pods/web-1/update", api.Pod{ObjectMeta: inOther}},
+		{"another pod", "/clusters/test/namespaces/rds/pods/web-1/update", api.Pod{ObjectMeta: renamed}},
+		{"endpoints in another namespace", "/clusters/test/namespaces/rds/endpoints/svc/update", api.Endpoints{ObjectMeta: api.ObjectMeta{Name: "svc", Namespace: "other"}}},
+		{"service created in another namespace", "/clusters/test/namespaces/rds/services", api.Service{ObjectMeta: api.ObjectMeta{Name: "new", Namespace: "other"}}},
+		{"another node", "/clusters/test/nodes/node-1/update", api.Node{ObjectMeta: api.ObjectMeta{Name: "node-2"}}},
+	}
+	for _, test := range tests {
+		r, fake := setUp(t, testObjects()...)
+		w := request(r, "owner", "POST", test.path, url.Values{"json": {toJSON(t, test.obj)}})
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, http.StatusForbidden)
+		}
+		if actions := writes(fake); len(actions) > 0 {
+			t.Errorf("%s: wrote %v", test.name, actions)
+		}
+	}
+}
+
+func TestOwnerCanDelete(t *testing.T) {
+	r, fake := setUp(t, testObjects()...)
+	w := request(r, "owner", "POST", "/clusters/test/namespaces/rds/services/svc/delete", url.Values{})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("got %d, want %d: %s", w.Code, http.StatusMovedPermanently, w.Body)
+	}
+	if actions := writes(fake); len(actions) != 1 || actions[0] != "delete services" {
+		t.Errorf("got writes %v, want [delete services]", actions)
+	}
+}
+
+func TestProxyRejectsDotDot(t *testing.T) {
+	r, _ := setUp(t, testObjects()...)
+	for _, path := range []string{
+		"/clusters/test/namespaces/rds/pods/web-1/proxy/80/../../../../secrets",
+		"/clusters/test/namespaces/rds/pods/web-1/proxy/80/a/..",
+	} {
+		// The path is not cleaned, the way curl --path-as-is sends it.
+		w := request(r, "owner", "GET", path, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", path, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/audit"
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/gin-gonic/gin"
+)
+
+// proxyPort returns the container port of a port shown in the pod list,
+// either "host->container" or a port of the host network, or "" if it can
+// not be proxied such as an UDP port.
+func proxyPort(port string) string {
+	if i := strings.LastIndex(port, "->"); i >= 0 {
+		port = port[i+len("->"):]
+	}
+	port = strings.TrimSuffix(port, "/TCP")
+	if _, err := strconv.Atoi(port); err != nil {
+		return ""
+	}
+	return port
+}
+
+// proxyPod proxies HTTP requests to a port of a pod for debugging. It needs
+// the same right as the terminal, since it reaches ports not exposed to
+// anyone else.
+func proxyPod(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+	port := c.Param("port")
+	path := c.Param("path")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": fmt.Sprintf("Invalid port %q", port)})
+		return
+	}
+	// The path goes after the proxy path of the pod on the API server, with
+	// the credentials of kubecon, so it must not climb out of it.
+	if hasDotDot(path) {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": fmt.Sprintf("Invalid path %q", path)})
+		return
+	}
+
+	prefix := fmt.Sprintf("/clusters/%s/namespaces/%s/pods/%s/proxy/%s", cluster, namespace, podname, port)
+	proxy, err := kubeclient.Get(cluster).PodProxy(namespace, podname, port, prefix)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	if c.Request.Method != "GET" && c.Request.Method != "HEAD" {
+		audit.Record(audit.Entry{
+			User:      signedInUser(c),
+			Action:    "proxy",
+			Cluster:   cluster,
+			Namespace: namespace,
+			Kind:      "Pod",
+			Name:      podname,
+			Detail:    fmt.Sprintf("%s :%s%s", c.Request.Method, port, path),
+		})
+	}
+	c.Request.URL.Path = path
+	c.Request.URL.RawPath = ""
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// hasDotDot tells if a path has a ".." segment.
+func hasDotDot(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
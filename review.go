@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/diff"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// serverFields are managed by the API server, which ignores or overwrites
+// what an edit puts in them.
+var serverFields = []string{
+	"status",
+	"metadata.uid",
+	"metadata.selfLink",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.deletionTimestamp",
+	"metadata.deletionGracePeriodSeconds",
+}
+
+func podEditTarget(cluster string, namespace string, name string) editTarget {
+	pods := kubeclient.Get(cluster).Pods(namespace)
+	return editTarget{
+		get:    func() (runtime.Object, error) { return pods.Get(name) },
+		update: func(obj runtime.Object) error { _, err := pods.Update(obj.(*api.Pod)); return err },
+		blank:  func() runtime.Object { return &api.Pod{} },
+	}
+}
+
+func replicationControllerEditTarget(cluster string, namespace string, name string) editTarget {
+	rcs := kubeclient.Get(cluster).ReplicationControllers(namespace)
+	return editTarget{
+		get:    func() (runtime.Object, error) { return rcs.Get(name) },
+		update: func(obj runtime.Object) error { _, err := rcs.Update(obj.(*api.ReplicationController)); return err },
+		blank:  func() runtime.Object { return &api.ReplicationController{} },
+	}
+}
+
+func serviceEditTarget(cluster string, namespace string, name string) editTarget {
+	svcs := kubeclient.Get(cluster).Services(namespace)
+	return editTarget{
+		get:    func() (runtime.Object, error) { return svcs.Get(name) },
+		update: func(obj runtime.Object) error { _, err := svcs.Update(obj.(*api.Service)); return err },
+		blank:  func() runtime.Object { return &api.Service{} },
+	}
+}
+
+func endpointsEditTarget(cluster string, namespace string, name string) editTarget {
+	eps := kubeclient.Get(cluster).Endpoints(namespace)
+	return editTarget{
+		get:    func() (runtime.Object, error) { return eps.Get(name) },
+		update: func(obj runtime.Object) error { _, err := eps.Update(obj.(*api.Endpoints)); return err },
+		blank:  func() runtime.Object { return &api.Endpoints{} },
+	}
+}
+
+func nodeEditTarget(cluster string, name string) editTarget {
+	nodes := kubeclient.Get(cluster).Nodes()
+	return editTarget{
+		get:    func() (runtime.Object, error) { return nodes.Get(name) },
+		update: func(obj runtime.Object) error { _, err := nodes.Update(obj.(*api.Node)); return err },
+		blank:  func() runtime.Object { return &api.Node{} },
+	}
+}
+
+// editChanges returns the changes an edit makes to the live object, except
+// the serverFields.
+func editChanges(live runtime.Object, mine runtime.Object) ([]diff.Change, error) {
+	changes, err := diff.Objects(live, mine)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Without(changes, serverFields...), nil
+}
+
+// reviewEdit tells if the posted edit has been confirmed. If not, it shows
+// the changes the edit makes to the live object, with a form to confirm.
+func reviewEdit(c *gin.Context, t editTarget, name string, editURL string, mine runtime.Object) bool {
+	if c.PostForm("confirm") == "true" {
+		return true
+	}
+	live, err := t.get()
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return false
+	}
+	changes, err := editChanges(live, mine)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return false
+	}
+	// Someone else updated the object since it was loaded into the editor,
+	// their changes are merged when the edit is confirmed.
+	stale := false
+	liveMeta, err1 := api.ObjectMetaFor(live)
+	mineMeta, err2 := api.ObjectMetaFor(mine)
+	if err1 == nil && err2 == nil {
+		stale = mineMeta.ResourceVersion != "" && mineMeta.ResourceVersion != liveMeta.ResourceVersion
+	}
+
+	c.HTML(http.StatusOK, "editReview", gin.H{
+		"cluster":   c.Param("cluster"),
+		"title":     name,
+		"name":      name,
+		"changes":   changes,
+		"stale":     stale,
+		"editURL":   editURL,
+		"updateURL": c.Request.URL.Path,
+		"json":      c.PostForm("json"),
+		"original":  c.PostForm("original"),
+	})
+	return false
+}
+
+// apiUpdateObject returns the API handler updating an object of kind with
+// the JSON body. With `?dryRun=true` it only returns the changes the update
+// would make.
+func apiUpdateObject(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cluster := c.Param("cluster")
+		namespace := c.Param("ns")
+
+		if !authorize(c, namespace, auth.Write) {
+			return
+		}
+
+		var t editTarget
+		var name string
+		switch kind {
+		case "Pod":
+			name = c.Param("po")
+			t = podEditTarget(cluster, namespace, name)
+		case "ReplicationController":
+			name = c.Param("rc")
+			t = replicationControllerEditTarget(cluster, namespace, name)
+		case "Service":
+			name = c.Param("svc")
+			t = serviceEditTarget(cluster, namespace, name)
+		case "Endpoints":
+			name = c.Param("ep")
+			t = endpointsEditTarget(cluster, namespace, name)
+		case "Node":
+			name = c.Param("no")
+			t = nodeEditTarget(cluster, name)
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown kind %q", kind)})
+			return
+		}
+
+		mine := t.blank()
+		if err := json.NewDecoder(c.Request.Body).Decode(mine); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		meta, err := api.ObjectMetaFor(mine)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !checkTarget(c, meta, namespace, name) {
+			return
+		}
+		live, err := t.get()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		changes, err := editChanges(live, mine)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("dryRun") == "true" {
+			c.JSON(http.StatusOK, gin.H{"dryRun": true, "changes": changes})
+			return
+		}
+
+		before, _, err := updateEdited(t, "", mine)
+		recordChange(signedInUser(c), "update", cluster, namespace, kind, name, before, mine, err)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if isConflict(err) {
+				code = http.StatusConflict
+			}
+			c.JSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"changes": changes})
+	}
+}
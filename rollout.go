@@ -0,0 +1,541 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/audit"
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// The states of a rollout.
+const (
+	RolloutRunning     = "Running"
+	RolloutPaused      = "Paused"
+	RolloutRollingBack = "RollingBack"
+	RolloutSucceeded   = "Succeeded"
+	RolloutRolledBack  = "RolledBack"
+	RolloutFailed      = "Failed"
+)
+
+// The states of a pod in a rollout.
+const (
+	StepPending    = "Pending"
+	StepUpgrading  = "Upgrading"
+	StepReady      = "Ready"
+	StepFailed     = "Failed"
+	StepRolledBack = "RolledBack"
+)
+
+// What to do when a pod is not ready in time.
+const (
+	OnFailureRollback = "rollback"
+	OnFailurePause    = "pause"
+)
+
+var (
+	rolloutPollInterval = 2 * time.Second
+	// maxRollouts is how many finished rollouts are kept for their pages.
+	maxRollouts = 100
+
+	rollouts     = make(map[string]*rollout)
+	rolloutsLock sync.RWMutex
+	rolloutSeq   int
+)
+
+// rollout upgrades the pods batch by batch in the background. A batch must
+// become ready before the next one starts, otherwise the upgraded pods are
+// rolled back, or the rollout pauses until resumed or aborted.
+type rollout struct {
+	sync.Mutex
+	page.Rollout
+	fullImages []string
+	// control receives "pause", "resume" or "abort".
+	control chan string
+}
+
+// view returns a copy of the progress, safe to render.
+func (r *rollout) view() page.Rollout {
+	r.Lock()
+	defer r.Unlock()
+	v := r.Rollout
+	v.Steps = append([]page.RolloutStep(nil), r.Steps...)
+	return v
+}
+
+func (r *rollout) finished() bool {
+	r.Lock()
+	defer r.Unlock()
+	return !r.Finished.IsZero()
+}
+
+func (r *rollout) setState(state string, message string) {
+	r.Lock()
+	defer r.Unlock()
+	r.State = state
+	if message != "" {
+		r.Message = message
+	}
+	switch state {
+	case RolloutSucceeded, RolloutRolledBack, RolloutFailed:
+		r.Finished = time.Now()
+	}
+	glog.Infof("Rollout %s of '%s/%s': %s %s", r.ID, r.Cluster, r.Namespace, state, message)
+}
+
+func (r *rollout) setStep(i int, state string, err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.Steps[i].State = state
+	if err != nil {
+		r.Steps[i].Error = err.Error()
+	}
+	r.Steps[i].Updated = time.Now()
+}
+
+func (r *rollout) step(i int) page.RolloutStep {
+	r.Lock()
+	defer r.Unlock()
+	return r.Steps[i]
+}
+
+// startRollout validates a rolling upgrade of pods and starts it. Images
+// are relative to the private repo as in doPodsAction.
+func startRollout(user string, cluster string, namespace string, action string, pods []string, images []string, batchSize int, timeout time.Duration, onFailure string) (*rollout, error) {
+	if action != "upgrade" && action != "downgrade" {
+		return nil, fmt.Errorf("Can not roll out action %q", action)
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("No pods to roll out")
+	}
+	fullImages := fullImageNames(images)
+	changed := false
+	for _, image := range fullImages {
+		changed = changed || image != ""
+	}
+	if !changed {
+		return nil, fmt.Errorf("No images to roll out")
+	}
+	if batchSize < 1 {
+		return nil, fmt.Errorf("Batch size must be at least 1")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("Timeout must be positive")
+	}
+	if onFailure == "" {
+		onFailure = OnFailureRollback
+	}
+	if onFailure != OnFailureRollback && onFailure != OnFailurePause {
+		return nil, fmt.Errorf("Unknown failure policy %q", onFailure)
+	}
+
+	r := &rollout{
+		Rollout: page.Rollout{
+			User:      user,
+			Cluster:   cluster,
+			Namespace: namespace,
+			Action:    action,
+			Images:    images,
+			BatchSize: batchSize,
+			Timeout:   timeout,
+			OnFailure: onFailure,
+			State:     RolloutRunning,
+			Created:   time.Now(),
+		},
+		fullImages: fullImages,
+		control:    make(chan string, 1),
+	}
+	for i, podname := range pods {
+		r.Steps = append(r.Steps, page.RolloutStep{Pod: podname, Batch: i/batchSize + 1, State: StepPending})
+	}
+
+	rolloutsLock.Lock()
+	rolloutSeq++
+	r.ID = fmt.Sprintf("%s-%d", r.Created.Format("20060102-150405"), rolloutSeq)
+	pruneRollouts()
+	rollouts[r.ID] = r
+	rolloutsLock.Unlock()
+
+	audit.Record(audit.Entry{
+		User:      user,
+		Action:    "rollout",
+		Cluster:   cluster,
+		Namespace: namespace,
+		Kind:      "Rollout",
+		Name:      r.ID,
+		Detail:    fmt.Sprintf("%s %d pods to %v, %d at a time", action, len(pods), images, batchSize),
+	})
+	go r.run()
+	return r, nil
+}
+
+// pruneRollouts forgets the oldest finished rollouts over maxRollouts. The
+// caller holds rolloutsLock.
+func pruneRollouts() {
+	var done []*rollout
+	for _, r := range rollouts {
+		if r.finished() {
+			done = append(done, r)
+		}
+	}
+	if len(done) < maxRollouts {
+		return
+	}
+	sort.Sort(byRolloutCreated(done))
+	for _, r := range done[:len(done)-maxRollouts+1] {
+		delete(rollouts, r.ID)
+	}
+}
+
+type byRolloutCreated []*rollout
+
+func (s byRolloutCreated) Len() int           { return len(s) }
+func (s byRolloutCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byRolloutCreated) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
+
+func getRollout(id string) *rollout {
+	rolloutsLock.RLock()
+	defer rolloutsLock.RUnlock()
+	return rollouts[id]
+}
+
+// listRolloutViews returns the rollouts in namespace of cluster, newest
+// first.
+func listRolloutViews(cluster string, namespace string) (views []page.Rollout) {
+	rolloutsLock.RLock()
+	for _, r := range rollouts {
+		if r.Cluster == cluster && r.Namespace == namespace {
+			views = append(views, r.view())
+		}
+	}
+	rolloutsLock.RUnlock()
+	sort.Sort(sort.Reverse(byRolloutViewCreated(views)))
+	return
+}
+
+type byRolloutViewCreated []page.Rollout
+
+func (s byRolloutViewCreated) Len() int           { return len(s) }
+func (s byRolloutViewCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byRolloutViewCreated) Less(i, j int) bool { return s[i].Created.Before(s[j].Created) }
+
+// controlRolloutBy asks a running rollout to pause, resume or abort.
+func controlRolloutBy(user string, r *rollout, control string) error {
+	if control != "pause" && control != "resume" && control != "abort" {
+		return fmt.Errorf("Unknown control %q", control)
+	}
+	if r.finished() {
+		return fmt.Errorf("Rollout %s has finished", r.ID)
+	}
+	select {
+	case r.control <- control:
+	default:
+		return fmt.Errorf("Rollout %s is busy, try again later", r.ID)
+	}
+	audit.Record(audit.Entry{
+		User:      user,
+		Action:    control,
+		Cluster:   r.Cluster,
+		Namespace: r.Namespace,
+		Kind:      "Rollout",
+		Name:      r.ID,
+	})
+	return nil
+}
+
+func (r *rollout) run() {
+	pausing := false
+	for start := 0; start < len(r.Steps); start += r.BatchSize {
+		end := start + r.BatchSize
+		if end > len(r.Steps) {
+			end = len(r.Steps)
+		}
+
+		select {
+		case control := <-r.control:
+			if control == "abort" {
+				r.rollback("Aborted")
+				return
+			}
+			pausing = pausing || control == "pause"
+		default:
+		}
+		if pausing {
+			r.setState(RolloutPaused, "Paused")
+			if !r.waitResume() {
+				r.rollback("Aborted")
+				return
+			}
+			pausing = false
+			r.setState(RolloutRunning, "Resumed")
+		}
+
+		// A failed batch is retried once resumed, the next one starts only
+		// when all its pods are ready.
+		for {
+			failed, aborted := r.upgradeBatch(start, end, &pausing)
+			if aborted {
+				r.rollback("Aborted")
+				return
+			}
+			if !failed {
+				break
+			}
+			batch := r.step(start).Batch
+			if r.OnFailure == OnFailureRollback {
+				r.rollback(fmt.Sprintf("Batch %d failed", batch))
+				return
+			}
+			r.setState(RolloutPaused, fmt.Sprintf("Batch %d failed, paused", batch))
+			if !r.waitResume() {
+				r.rollback("Aborted")
+				return
+			}
+			pausing = false
+			r.setState(RolloutRunning, fmt.Sprintf("Resumed, retrying batch %d", batch))
+		}
+	}
+	if n := r.unreadySteps(); n > 0 {
+		r.setState(RolloutFailed, fmt.Sprintf("%d pods are not ready", n))
+		return
+	}
+	r.setState(RolloutSucceeded, "All pods are ready")
+}
+
+func (r *rollout) unreadySteps() (n int) {
+	r.Lock()
+	defer r.Unlock()
+	for _, step := range r.Steps {
+		if step.State != StepReady {
+			n++
+		}
+	}
+	return
+}
+
+// upgradeBatch upgrades the pods of steps [start, end) and waits until they
+// are ready. A pause requested meanwhile takes effect before the next batch.
+// When the batch is retried, the pods ready are left alone and the ones
+// upgraded already are only waited for again.
+func (r *rollout) upgradeBatch(start int, end int, pausing *bool) (failed bool, aborted bool) {
+	for i := start; i < end; i++ {
+		step := r.step(i)
+		if step.State == StepReady {
+			continue
+		}
+		r.Lock()
+		r.Steps[i].Error = ""
+		r.Unlock()
+		if step.Previous != nil {
+			r.setStep(i, StepUpgrading, nil)
+			continue
+		}
+		podname := step.Pod
+		previous, err := setPodImage(r.User, r.Action, r.Cluster, r.Namespace, podname, r.fullImages)
+		if err != nil {
+			r.setStep(i, StepFailed, err)
+			failed = true
+			continue
+		}
+		r.Lock()
+		r.Steps[i].Previous = previous
+		r.Unlock()
+		r.setStep(i, StepUpgrading, nil)
+	}
+
+	deadline := time.After(r.Timeout)
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	for {
+		waiting := 0
+		for i := start; i < end; i++ {
+			if r.step(i).State != StepUpgrading {
+				continue
+			}
+			pod, err := kubeclient.Get(r.Cluster).Pods(r.Namespace).Get(r.step(i).Pod)
+			if err != nil {
+				glog.Warningf("Rollout %s can not get pod %q: %v", r.ID, r.step(i).Pod, err)
+				waiting++
+			} else if podUpgraded(pod, r.fullImages) {
+				r.setStep(i, StepReady, nil)
+			} else {
+				waiting++
+			}
+		}
+		if waiting == 0 {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case control := <-r.control:
+			switch control {
+			case "abort":
+				return failed, true
+			case "pause":
+				*pausing = true
+			}
+		case <-deadline:
+			for i := start; i < end; i++ {
+				if r.step(i).State == StepUpgrading {
+					r.setStep(i, StepFailed, fmt.Errorf("Not ready after %v", r.Timeout))
+				}
+			}
+			return true, false
+		}
+	}
+}
+
+// waitResume blocks a paused rollout until it is resumed or aborted.
+func (r *rollout) waitResume() bool {
+	for control := range r.control {
+		switch control {
+		case "resume":
+			return true
+		case "abort":
+			return false
+		}
+	}
+	return false
+}
+
+// podUpgraded tells if the containers of pod run the images and all of them
+// are ready, the same way as the pod list counts them.
+func podUpgraded(pod *api.Pod, fullImages []string) bool {
+	p := genOnePod(pod)
+	if p.ReadyContainers != p.TotalContainers {
+		return false
+	}
+	for i, image := range fullImages {
+		if image == "" {
+			continue
+		}
+		if i >= len(pod.Spec.Containers) {
+			return false
+		}
+		name := pod.Spec.Containers[i].Name
+		running := false
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == name && status.Image == image && status.Ready {
+				running = true
+			}
+		}
+		if !running {
+			return false
+		}
+	}
+	return true
+}
+
+// rollback sets the previous images back to the pods already upgraded.
+func (r *rollout) rollback(reason string) {
+	r.setState(RolloutRollingBack, reason)
+	var errs []string
+	for i := range r.Steps {
+		step := r.step(i)
+		if step.Previous == nil || step.State == StepRolledBack {
+			continue
+		}
+		var images []string
+		for j, image := range r.fullImages {
+			if image != "" && j < len(step.Previous) {
+				images = append(images, step.Previous[j])
+			} else {
+				images = append(images, "")
+			}
+		}
+		if _, err := setPodImage(r.User, "rollback", r.Cluster, r.Namespace, step.Pod, images); err != nil {
+			r.setStep(i, step.State, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", step.Pod, err))
+			continue
+		}
+		r.setStep(i, StepRolledBack, nil)
+	}
+	if len(errs) > 0 {
+		r.setState(RolloutFailed, fmt.Sprintf("%s, rollback failed: %v", reason, errs))
+	} else {
+		r.setState(RolloutRolledBack, reason+", rolled back")
+	}
+}
+
+// rolloutOptions reads the batch size, timeout in seconds and failure
+// policy of a rolling upgrade posted from the pod form.
+func rolloutOptions(c *gin.Context) (batchSize int, timeout time.Duration, onFailure string, err error) {
+	batchSize, err = strconv.Atoi(c.DefaultPostForm("batch", "1"))
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("Invalid batch size: %v", err)
+	}
+	seconds, err := strconv.Atoi(c.DefaultPostForm("timeout", "300"))
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("Invalid timeout: %v", err)
+	}
+	return batchSize, time.Duration(seconds) * time.Second, c.PostForm("onFailure"), nil
+}
+
+func listRollouts(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	c.HTML(http.StatusOK, "rolloutList", gin.H{
+		"cluster":   cluster,
+		"title":     namespace,
+		"namespace": namespace,
+		"rollouts":  listRolloutViews(cluster, namespace),
+	})
+}
+
+// findRollout returns the rollout of the request, or renders an error.
+func findRollout(c *gin.Context) *rollout {
+	r := getRollout(c.Param("id"))
+	if r == nil || r.Cluster != c.Param("cluster") || r.Namespace != c.Param("ns") {
+		renderError(c, http.StatusNotFound, fmt.Sprintf("Rollout %q not found", c.Param("id")))
+		return nil
+	}
+	return r
+}
+
+func showRollout(c *gin.Context) {
+	r := findRollout(c)
+	if r == nil {
+		return
+	}
+	view := r.view()
+	refresh := ""
+	if view.Finished.IsZero() {
+		refresh = "3"
+	}
+
+	c.HTML(http.StatusOK, "rolloutDetail", gin.H{
+		"cluster":   view.Cluster,
+		"title":     view.ID,
+		"namespace": view.Namespace,
+		"rollout":   view,
+		"refresh":   refresh,
+	})
+}
+
+func controlRollout(c *gin.Context) {
+	if !authorize(c, c.Param("ns"), auth.Write) {
+		return
+	}
+	r := findRollout(c)
+	if r == nil {
+		return
+	}
+	if err := controlRolloutBy(signedInUser(c), r, c.PostForm("control")); err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/rollouts/%s", r.Cluster, r.Namespace, r.ID))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aclisp/kubecon/pkg/page"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// waitRollout waits until the rollout is in state.
+func waitRollout(t *testing.T, r *rollout, state string) page.Rollout {
+	var view page.Rollout
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if view = r.view(); view.State == state {
+			return view
+		}
+	}
+	t.Fatalf("rollout is %s (%s), want %s", view.State, view.Message, state)
+	return view
+}
+
+func TestRolloutRetriesFailedBatchOnResume(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+	_, fake := setUp(t, testObjects()...)
+
+	r, err := startRollout("operator", testCluster, "rds", "upgrade", []string{"web-1"}, []string{"web:2.0.0"}, 1, 100*time.Millisecond, OnFailurePause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pod is not ready in time.
+	view := waitRollout(t, r, RolloutPaused)
+	if step := view.Steps[0]; step.State != StepFailed || step.Error == "" {
+		t.Fatalf("got step %+v, want it failed", step)
+	}
+
+	// Resumed, the batch fails again while the pod is not ready.
+	if err := controlRolloutBy("operator", r, "resume"); err != nil {
+		t.Fatal(err)
+	}
+	waitRollout(t, r, RolloutRunning)
+	view = waitRollout(t, r, RolloutPaused)
+	if !view.Finished.IsZero() {
+		t.Fatalf("got %+v, want it not finished", view)
+	}
+
+	pod, err := fake.Pods("rds").Get("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := pod.Spec.Containers[0].Image
+	if image != r.fullImages[0] {
+		t.Fatalf("pod runs %q, want %q", image, r.fullImages[0])
+	}
+	pod.Status.ContainerStatuses = []api.ContainerStatus{{
+		Name:  "web",
+		Image: image,
+		Ready: true,
+		State: api.ContainerState{Running: &api.ContainerStateRunning{}},
+	}}
+	if _, err := fake.Pods("rds").Update(pod); err != nil {
+		t.Fatal(err)
+	}
+	if err := controlRolloutBy("operator", r, "resume"); err != nil {
+		t.Fatal(err)
+	}
+
+	view = waitRollout(t, r, RolloutSucceeded)
+	step := view.Steps[0]
+	if step.State != StepReady || step.Error != "" || !reflect.DeepEqual(step.Previous, []string{"web:1.0.0"}) {
+		t.Errorf("got step %+v, want it ready, upgraded from web:1.0.0", step)
+	}
+}
+
+func TestRolloutAbortedWhilePausedRollsBack(t *testing.T) {
+	defer func(interval time.Duration) { rolloutPollInterval = interval }(rolloutPollInterval)
+	rolloutPollInterval = 10 * time.Millisecond
+	_, fake := setUp(t, testObjects()...)
+
+	r, err := startRollout("operator", testCluster, "rds", "upgrade", []string{"web-1"}, []string{"web:2.0.0"}, 1, 50*time.Millisecond, OnFailurePause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitRollout(t, r, RolloutPaused)
+	if err := controlRolloutBy("operator", r, "abort"); err != nil {
+		t.Fatal(err)
+	}
+	waitRollout(t, r, RolloutRolledBack)
+	pod, err := fake.Pods("rds").Get("web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := pod.Spec.Containers[0].Image; image != "web:1.0.0" {
+		t.Errorf("pod runs %q after the rollback, want web:1.0.0", image)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/jobs"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/schedule"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// scheduleActions are the pod actions a schedule can perform.
+var scheduleActions = []string{"stop", "start", "restart", "sync", "upgrade-latest"}
+
+// runSchedule queues a background job doing the action of a schedule on
+// the pods matching its selector. It is done as the user who added the
+// schedule, who must still be allowed to.
+func runSchedule(s schedule.Schedule) ([]string, string, error) {
+	if !auth.Allowed(s.User, s.Cluster, s.Namespace, auth.Write) {
+		return nil, "", fmt.Errorf("User %q has no %s permission on %q", s.User, auth.Write, s.Cluster+"/"+s.Namespace)
+	}
+	if _, ok := kubeclient.Lookup(s.Cluster); !ok {
+		return nil, "", fmt.Errorf("Cluster %q not found", s.Cluster)
+	}
+	selector, err := labels.Parse(s.Selector)
+	if err != nil {
+		return nil, "", err
+	}
+	list, err := kubeclient.Get(s.Cluster).Pods(s.Namespace).List(selector, fields.Everything())
+	if err != nil {
+		return nil, "", err
+	}
+	var pods []string
+	for i := range list.Items {
+		pods = append(pods, list.Items[i].Name)
+	}
+	if len(pods) == 0 {
+		return nil, "", fmt.Errorf("No pods match %q", s.Selector)
+	}
+	id, err := submitPodsJob(s.User, s.Cluster, s.Namespace, s.Action, pods, nil, s.Checks)
+	return pods, id, err
+}
+
+// newSchedule validates a schedule of user and adds it.
+func newSchedule(user string, cluster string, namespace string, selector string, action string, checks []bool, cron string) (schedule.Schedule, error) {
+	known := false
+	for _, a := range scheduleActions {
+		known = known || a == action
+	}
+	if !known {
+		return schedule.Schedule{}, fmt.Errorf("Action %q can not be scheduled", action)
+	}
+	if _, err := labels.Parse(selector); err != nil {
+		return schedule.Schedule{}, err
+	}
+	s, err := schedule.Add(schedule.Schedule{
+		User:      user,
+		Cluster:   cluster,
+		Namespace: namespace,
+		Selector:  selector,
+		Action:    action,
+		Checks:    checks,
+		Cron:      cron,
+	})
+	if err != nil {
+		return s, err
+	}
+	recordChange(user, "schedule", cluster, namespace, "Schedule", s.ID, nil, s, nil)
+	return s, nil
+}
+
+// controlScheduleBy enables, disables, runs or deletes a schedule as user.
+func controlScheduleBy(user string, s schedule.Schedule, control string) error {
+	var err error
+	switch control {
+	case "enable":
+		err = schedule.Enable(s.ID, true)
+	case "disable":
+		err = schedule.Enable(s.ID, false)
+	case "run":
+		err = schedule.RunNow(s.ID)
+	case "delete":
+		err = schedule.Delete(s.ID)
+	default:
+		return fmt.Errorf("Unknown control %q", control)
+	}
+	recordChange(user, control, s.Cluster, s.Namespace, "Schedule", s.ID, nil, nil, err)
+	return err
+}
+
+// findSchedule returns the schedule of the request, or renders an error.
+func findSchedule(c *gin.Context) (schedule.Schedule, bool) {
+	s, ok := schedule.Get(c.Param("id"))
+	if !ok || s.Cluster != c.Param("cluster") || s.Namespace != c.Param("ns") {
+		renderError(c, http.StatusNotFound, fmt.Sprintf("Schedule %q not found", c.Param("id")))
+		return s, false
+	}
+	return s, true
+}
+
+func namespaceSchedules(cluster string, namespace string) []schedule.Schedule {
+	return schedule.List(func(s *schedule.Schedule) bool {
+		return s.Cluster == cluster && s.Namespace == namespace
+	})
+}
+
+func listSchedules(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	c.HTML(http.StatusOK, "scheduleList", gin.H{
+		"cluster":   cluster,
+		"title":     namespace,
+		"namespace": namespace,
+		"schedules": namespaceSchedules(cluster, namespace),
+		"actions":   scheduleActions,
+	})
+}
+
+func createSchedule(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	checks, err := containerChecks(c.PostForm("containers"))
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+	s, err := newSchedule(signedInUser(c), cluster, namespace, c.PostForm("selector"), c.PostForm("action"), checks, c.PostForm("cron"))
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/schedules/%s", cluster, namespace, s.ID))
+}
+
+// containerChecks selects the containers of a comma separated list of
+// indexes, such as "0,1".
+func containerChecks(indexes string) (checks []bool, err error) {
+	for _, s := range strings.Split(indexes, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("Invalid container index %q", s)
+		}
+		for len(checks) <= i {
+			checks = append(checks, false)
+		}
+		checks[i] = true
+	}
+	return checks, nil
+}
+
+// scheduleRun is a run of a schedule with the state of its job.
+type scheduleRun struct {
+	schedule.Run
+	State string
+}
+
+func showSchedule(c *gin.Context) {
+	s, ok := findSchedule(c)
+	if !ok {
+		return
+	}
+	var runs []scheduleRun
+	for _, run := range s.Runs {
+		state := jobs.Failed
+		if run.Job != "" {
+			// The jobs are pruned sooner than the runs.
+			state = ""
+			if job, ok := jobs.Get(run.Job); ok {
+				state = job.State
+			}
+		}
+		runs = append(runs, scheduleRun{Run: run, State: state})
+	}
+
+	c.HTML(http.StatusOK, "scheduleDetail", gin.H{
+		"cluster":   s.Cluster,
+		"title":     s.ID,
+		"namespace": s.Namespace,
+		"schedule":  s,
+		"runs":      runs,
+	})
+}
+
+func controlSchedule(c *gin.Context) {
+	if !authorize(c, c.Param("ns"), auth.Write) {
+		return
+	}
+	s, ok := findSchedule(c)
+	if !ok {
+		return
+	}
+	control := c.PostForm("control")
+	if err := controlScheduleBy(signedInUser(c), s, control); err != nil {
+		c.HTML(http.StatusBadRequest, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	if control == "delete" {
+		c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/schedules", s.Cluster, s.Namespace))
+		return
+	}
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/namespaces/%s/schedules/%s", s.Cluster, s.Namespace, s.ID))
+}
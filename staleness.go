@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/gin-gonic/gin"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// genStaleImages lists the distinct images the pods run, the most stale
+// first. Suspended pods count for the images they were running.
+func genStaleImages(pods []*api.Pod) []page.StaleImage {
+	found := make(map[string]*page.StaleImage)
+	// The tags are listed once per repository.
+	tags := make(map[string][]string)
+	for _, pod := range pods {
+		spec, _, err := runningSpec(pod)
+		if err != nil {
+			spec = pod.Spec
+		}
+		for _, image := range populatePodImages(spec.Containers) {
+			s, ok := found[image.Image]
+			if !ok {
+				name, tag := splitImage(image.Image)
+				s = &page.StaleImage{
+					Image:       image.Image,
+					Tag:         tag,
+					Behind:      -1,
+					PrivateRepo: image.PrivateRepo,
+					Latest:      tag == "latest",
+				}
+				found[image.Image] = s
+				if image.PrivateRepo {
+					if _, ok := tags[name]; !ok {
+						tags[name] = getImageTags(name)
+					}
+					setStaleness(s, tags[name])
+				}
+			}
+			if n := len(s.Pods); n == 0 || s.Pods[n-1] != (page.ImageUser{Namespace: pod.Namespace, Name: pod.Name}) {
+				s.Pods = append(s.Pods, page.ImageUser{Namespace: pod.Namespace, Name: pod.Name})
+			}
+		}
+	}
+
+	images := make([]page.StaleImage, 0, len(found))
+	for _, s := range found {
+		images = append(images, *s)
+	}
+	sort.Sort(byStaleness(images))
+	return images
+}
+
+// setStaleness counts the tags of the repository, oldest first by its
+// version policy, newer than the tag of s.
+func setStaleness(s *page.StaleImage, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	s.Newest = tags[len(tags)-1]
+	if i := indexOf(tags, s.Tag); i >= 0 {
+		s.Behind = len(tags) - 1 - i
+	}
+}
+
+type byStaleness []page.StaleImage
+
+func (s byStaleness) Len() int      { return len(s) }
+func (s byStaleness) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byStaleness) Less(i, j int) bool {
+	if s[i].Behind != s[j].Behind {
+		return s[i].Behind > s[j].Behind
+	}
+	return s[i].Image < s[j].Image
+}
+
+// genNamespaceStaleImages reports the images of the pods in namespace.
+func genNamespaceStaleImages(cluster string, namespace string) ([]page.StaleImage, error) {
+	list, err := kubeclient.Get(cluster).Pods(namespace).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var pods []*api.Pod
+	for i := range list.Items {
+		pods = append(pods, &list.Items[i])
+	}
+	return genStaleImages(pods), nil
+}
+
+// genNodeStaleImages reports the images of the pods on the node, in the
+// namespaces the user can read.
+func genNodeStaleImages(user string, cluster string, nodename string) ([]page.StaleImage, error) {
+	allPods, err := kubeclient.GetAllPods(cluster)
+	if err != nil {
+		return nil, err
+	}
+	var pods []*api.Pod
+	for _, pod := range allPods {
+		if pod.Spec.NodeName == nodename && auth.Allowed(user, cluster, pod.Namespace, auth.Read) {
+			pods = append(pods, pod)
+		}
+	}
+	return genStaleImages(pods), nil
+}
+
+// renderStaleImages shows the report, or exports it with `?format=csv` or
+// `?format=json` as a file named after the namespace or the node.
+func renderStaleImages(c *gin.Context, name string, images []page.StaleImage, data gin.H) {
+	filename := fmt.Sprintf("staleness-%s-%s", c.Param("cluster"), name)
+	switch c.Query("format") {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		c.JSON(http.StatusOK, images)
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writeStaleImagesCSV(c.Writer, images)
+	default:
+		var stale, public, latest int
+		for _, s := range images {
+			if s.Behind > 0 {
+				stale++
+			}
+			if !s.PrivateRepo {
+				public++
+			}
+			if s.Latest {
+				latest++
+			}
+		}
+		data["cluster"] = c.Param("cluster")
+		data["images"] = images
+		data["title"] = name
+		data["stale"], data["public"], data["latest"] = stale, public, latest
+		c.HTML(http.StatusOK, "stalenessList", data)
+	}
+}
+
+func writeStaleImagesCSV(w io.Writer, images []page.StaleImage) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"image", "tag", "newest", "behind", "private", "latest", "pods"})
+	for _, s := range images {
+		behind := ""
+		if s.Behind >= 0 {
+			behind = strconv.Itoa(s.Behind)
+		}
+		var pods []string
+		for _, p := range s.Pods {
+			pods = append(pods, p.Namespace+"/"+p.Name)
+		}
+		out.Write([]string{s.Image, s.Tag, s.Newest, behind, strconv.FormatBool(s.PrivateRepo), strconv.FormatBool(s.Latest), strings.Join(pods, " ")})
+	}
+	out.Flush()
+}
+
+func listNamespaceStaleImages(c *gin.Context) {
+	namespace := c.Param("ns")
+
+	images, err := genNamespaceStaleImages(c.Param("cluster"), namespace)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	renderStaleImages(c, namespace, images, gin.H{"namespace": namespace})
+}
+
+func listNodeStaleImages(c *gin.Context) {
+	nodename := c.Param("no")
+
+	images, err := genNodeStaleImages(signedInUser(c), c.Param("cluster"), nodename)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+	renderStaleImages(c, nodename, images, gin.H{"node": nodename})
+}
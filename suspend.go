@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aclisp/kubecon/pkg/auth"
+	"github.com/aclisp/kubecon/pkg/kubeclient"
+	"github.com/aclisp/kubecon/pkg/page"
+	"github.com/aclisp/kubecon/pkg/suspend"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// genSuspendedPods returns the pods not running as usual in the namespaces
+// of cluster the user can read.
+func genSuspendedPods(user string, cluster string) ([]page.SuspendedPod, error) {
+	list, err := kubeclient.Get(cluster).Pods(api.NamespaceAll).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var pods []page.SuspendedPod
+	for i := range list.Items {
+		pod := &list.Items[i]
+		if !auth.Allowed(user, cluster, pod.Namespace, auth.Read) {
+			continue
+		}
+		state, problems := suspend.Check(pod)
+		if state == suspend.Running {
+			continue
+		}
+		p := page.SuspendedPod{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			State:     state,
+			Problems:  problems,
+		}
+		containers, _ := suspend.Get(pod)
+		for _, c := range containers {
+			p.Containers = append(p.Containers, page.SuspendedContainer{Name: c.Name, Image: c.Image, Time: c.Time, User: c.User})
+		}
+		pods = append(pods, p)
+	}
+	return pods, nil
+}
+
+func listSuspendedPods(c *gin.Context) {
+	cluster := c.Param("cluster")
+
+	pods, err := genSuspendedPods(signedInUser(c), cluster)
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.HTML(http.StatusOK, "suspendedList", gin.H{
+		"cluster": cluster,
+		"title":   "Sigma Suspended",
+		"pods":    pods,
+	})
+}
+
+// recoverSuspendedPod fixes a pod left half stopped, starting the containers
+// without a recorded image with the image of its replication controller.
+func recoverSuspendedPod(c *gin.Context) {
+	cluster := c.Param("cluster")
+	namespace := c.Param("ns")
+	podname := c.Param("po")
+
+	if !authorize(c, namespace, auth.Write) {
+		return
+	}
+
+	err := modifyPod(signedInUser(c), "recover", cluster, namespace, podname, func(pod *api.Pod) error {
+		done, err := suspend.Recover(pod, func(container string) (string, bool) {
+			return templateImage(cluster, namespace, pod, container)
+		})
+		for _, d := range done {
+			glog.Infof("Recover pod '%s/%s': %s", namespace, podname, d)
+		}
+		return err
+	})
+	if err != nil {
+		c.HTML(http.StatusInternalServerError, "error", gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Redirect(http.StatusMovedPermanently, fmt.Sprintf("/clusters/%s/suspended", cluster))
+}
+
+// templateImage returns the image of a container in the template of the
+// replication controller managing pod.
+func templateImage(cluster string, namespace string, pod *api.Pod, container string) (string, bool) {
+	rcname, ok := pod.Labels["managed-by"]
+	if !ok {
+		return "", false
+	}
+	rc, err := kubeclient.Get(cluster).ReplicationControllers(namespace).Get(rcname)
+	if err != nil || rc.Spec.Template == nil {
+		return "", false
+	}
+	for i := range rc.Spec.Template.Spec.Containers {
+		if rc.Spec.Template.Spec.Containers[i].Name == container {
+			return rc.Spec.Template.Spec.Containers[i].Image, true
+		}
+	}
+	return "", false
+}